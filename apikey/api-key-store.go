@@ -0,0 +1,223 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nillga/mehm-services-api-gateway/policy"
+)
+
+// Scope limits what a key may be used for.
+type Scope string
+
+const (
+	ReadMehms    Scope = "mehms:read"
+	PostComments Scope = "comments:post"
+	Admin        Scope = "admin"
+)
+
+// scopePermissions maps the scopes below admin to the route permissions they unlock.
+var scopePermissions = map[Scope][]policy.Permission{
+	ReadMehms:    {policy.ReadMehms, policy.ReadComments},
+	PostComments: {policy.ReadComments, policy.PostComments},
+}
+
+const prefix = "mk_"
+
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Key describes an API key. Only the hash of its secret is stored.
+type Key struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	Scopes    []Scope   `json:"scopes"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (k *Key) HasScope(scope Scope) bool {
+	for _, candidate := range k.Scopes {
+		if candidate == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants tells whether the key may be used on a route with the given permission.
+func (k *Key) Grants(permission policy.Permission) policy.Scope {
+	if k.HasScope(Admin) {
+		return policy.Any
+	}
+	for _, scope := range k.Scopes {
+		for _, granted := range scopePermissions[scope] {
+			if granted == permission {
+				return policy.Own
+			}
+		}
+	}
+	return policy.None
+}
+
+func ValidScope(scope Scope) bool {
+	_, ok := scopePermissions[scope]
+	return ok || scope == Admin
+}
+
+type Store interface {
+	// Create returns the new key together with its secret, which cannot be recovered later.
+	Create(name string, scopes []Scope, createdBy string) (*Key, string, error)
+	List() ([]Key, error)
+	Revoke(id string) error
+	Resolve(secret string) (*Key, error)
+}
+
+type fileStore struct {
+	file string
+
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewFileStore keeps keys in a JSON file. Without a file keys only live in memory.
+func NewFileStore(file string) (Store, error) {
+	s := &fileStore{file: file, keys: map[string]Key{}}
+	if file == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading API key file: %w", err)
+	}
+	if len(content) > 0 {
+		if err = json.Unmarshal(content, &s.keys); err != nil {
+			return nil, fmt.Errorf("parsing API key file %s: %w", file, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *fileStore) Create(name string, scopes []Scope, createdBy string) (*Key, string, error) {
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return nil, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	id, err := random(9)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := random(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = prefix + id + "_" + secret
+
+	key := Key{
+		Id:        id,
+		Name:      name,
+		Hash:      hash(secret),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[id] = key
+	if err = s.persist(); err != nil {
+		delete(s.keys, id)
+		return nil, "", err
+	}
+
+	key.Hash = ""
+	return &key, secret, nil
+}
+
+func (s *fileStore) List() ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		key.Hash = ""
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *fileStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("API key %s does not exist", id)
+	}
+	delete(s.keys, id)
+	if err := s.persist(); err != nil {
+		s.keys[id] = key
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) Resolve(secret string) (*Key, error) {
+	parts := strings.SplitN(strings.TrimPrefix(secret, prefix), "_", 2)
+	if !strings.HasPrefix(secret, prefix) || len(parts) != 2 {
+		return nil, ErrInvalidKey
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[parts[0]]
+	s.mu.RUnlock()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(secret))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	key.Hash = ""
+	return &key, nil
+}
+
+func (s *fileStore) persist() error {
+	if s.file == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err = os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func random(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(base64.RawURLEncoding.EncodeToString(raw), "_", "-"), nil
+}
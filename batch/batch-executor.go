@@ -0,0 +1,251 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/nillga/mehm-services-api-gateway/utils"
+	"github.com/nillga/mehm-services-api-gateway/validation"
+)
+
+// Request is one operation of a batch. Path is a route of the gateway below
+// /api/ including its query, Body the JSON body of a POST.
+type Request struct {
+	Id     string          `json:"id,omitempty" maxlength:"64"`
+	Method string          `json:"method" enum:"GET,POST"`
+	Path   string          `json:"path" minlength:"1" maxlength:"2048"`
+	Body   json.RawMessage `json:"body,omitempty" swaggertype:"object"`
+}
+
+// Response is the outcome of the request at the same position of a batch.
+// Bodies that are not JSON, like images, are returned as base64 string with
+// Encoding set to "base64".
+type Response struct {
+	Id       string            `json:"id,omitempty"`
+	Status   int               `json:"status"`
+	Header   map[string]string `json:"header,omitempty"`
+	Body     json.RawMessage   `json:"body,omitempty" swaggertype:"object"`
+	Encoding string            `json:"encoding,omitempty" enum:"base64"`
+}
+
+// base64Encoding marks a Response whose body is a base64 string.
+const base64Encoding = "base64"
+
+// relayedHeaders are the response headers of an operation worth telling the client.
+var relayedHeaders = []string{"Content-Type", "X-Total-Count", "Link", "Retry-After"}
+
+type Executor interface {
+	Batch(w http.ResponseWriter, r *http.Request)
+}
+
+type Options struct {
+	// MaxRequests bounds the operations of one batch.
+	MaxRequests int
+	// Concurrency bounds the operations of one batch that run at the same time.
+	Concurrency int
+	// MaxBodySize bounds the body of one operation in bytes.
+	MaxBodySize int
+	// MaxResponseSize bounds the response body of one operation in bytes.
+	MaxResponseSize int
+}
+
+type executor struct {
+	next http.Handler
+	opts Options
+}
+
+// NewExecutor runs the operations of a batch through next, which has to
+// authorize them on its own.
+func NewExecutor(next http.Handler, opts Options) Executor {
+	return &executor{next: next, opts: opts}
+}
+
+// Batch godoc
+// @Summary      Run several requests at once
+// @Security bearerToken
+// @Security apiKey
+// @Description  Every request is authorized like it was sent on its own, with the credentials of the batch. They run concurrently, so a request must not depend on the outcome of another one. The responses are in the order of the requests. Cookies set by a request are dropped. Bodies that are not JSON are returned base64 encoded, marked by encoding. Responses larger than the configured limit are replaced by an error, such requests have to be sent on their own.
+// @Tags         batch
+// @Accept       json
+// @Produce      json
+// @Param        input   body      []batch.Request  true  "The requests"
+// @Success      200  {object}  []batch.Response{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
+// @Router       /batch [post]
+func (e *executor) Batch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requests []Request
+	err := validation.Decode(r, &requests, int64(e.opts.MaxRequests)*int64(e.opts.MaxBodySize))
+	var invalid *validation.Error
+	switch {
+	case errors.As(err, &invalid):
+		utils.InvalidInput(w, http.StatusUnprocessableEntity, invalid)
+		return
+	case errors.Is(err, validation.ErrBodyTooLarge):
+		utils.RequestEntityTooLarge(w, err)
+		return
+	case err != nil:
+		utils.BadRequest(w, err)
+		return
+	}
+	if len(requests) < 1 || len(requests) > e.opts.MaxRequests {
+		utils.UnprocessableEntity(w, fmt.Errorf("a batch holds 1-%d requests", e.opts.MaxRequests))
+		return
+	}
+
+	responses := make([]Response, len(requests))
+	slots := make(chan struct{}, e.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			responses[i] = e.run(r, requests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(responses); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// run serves one operation with the headers, and so the credentials, of the batch.
+// A panicking operation fails on its own instead of taking down the batch.
+func (e *executor) run(batch *http.Request, request Request) (response Response) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("batch request %s %s panicked: %v", request.Method, request.Path, p)
+			rec := newRecorder(0)
+			rec.Header().Set("Content-Type", "application/json")
+			utils.InternalServerError(rec, fmt.Errorf("request failed unexpectedly"))
+			response = rec.response(request.Id)
+		}
+	}()
+
+	rec := newRecorder(e.opts.MaxResponseSize)
+	sub, err := e.subRequest(batch, request)
+	switch {
+	case errors.Is(err, validation.ErrBodyTooLarge):
+		rec.Header().Set("Content-Type", "application/json")
+		utils.RequestEntityTooLarge(rec, err)
+	case err != nil:
+		rec.Header().Set("Content-Type", "application/json")
+		utils.BadRequest(rec, err)
+	default:
+		e.next.ServeHTTP(rec, sub)
+	}
+	if rec.truncated {
+		rec = newRecorder(0)
+		rec.Header().Set("Content-Type", "application/json")
+		utils.InternalServerError(rec, fmt.Errorf("response exceeds %d bytes, send the request on its own", e.opts.MaxResponseSize))
+	}
+	return rec.response(request.Id)
+}
+
+func (e *executor) subRequest(batch *http.Request, request Request) (*http.Request, error) {
+	target, err := url.Parse(request.Path)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "" || target.Host != "" || !strings.HasPrefix(target.Path, "/api/") || path.Clean(target.Path) != target.Path {
+		return nil, fmt.Errorf("path %s is no route of the gateway", request.Path)
+	}
+	if target.Path == batch.URL.Path {
+		return nil, fmt.Errorf("batches cannot be nested")
+	}
+	if len(request.Body) > e.opts.MaxBodySize {
+		return nil, validation.ErrBodyTooLarge
+	}
+
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	sub, err := http.NewRequestWithContext(batch.Context(), method, target.RequestURI(), bytes.NewReader(request.Body))
+	if err != nil {
+		return nil, err
+	}
+	sub.Header = batch.Header.Clone()
+	sub.Header.Del("Content-Length")
+	sub.Header.Del("Content-Type")
+	if len(request.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	sub.Host = batch.Host
+	sub.RemoteAddr = batch.RemoteAddr
+	return sub, nil
+}
+
+// recorder keeps the response of an operation in memory, up to limit bytes of
+// its body if limit is positive. Anything beyond is dropped and marks it truncated.
+type recorder struct {
+	header    http.Header
+	status    int
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newRecorder(limit int) *recorder {
+	return &recorder{header: http.Header{}, limit: limit}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if r.limit > 0 && r.body.Len()+len(p) > r.limit {
+		r.truncated = true
+		return len(p), nil
+	}
+	return r.body.Write(p)
+}
+
+func (r *recorder) response(id string) Response {
+	response := Response{Id: id, Status: r.status}
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	for _, name := range relayedHeaders {
+		if value := r.header.Get(name); value != "" {
+			if response.Header == nil {
+				response.Header = map[string]string{}
+			}
+			response.Header[name] = value
+		}
+	}
+
+	switch body := r.body.Bytes(); {
+	case len(bytes.TrimSpace(body)) == 0:
+	case json.Valid(body):
+		response.Body = bytes.TrimSpace(body)
+	default:
+		response.Body, _ = json.Marshal(base64.StdEncoding.EncodeToString(body))
+		response.Encoding = base64Encoding
+	}
+	return response
+}
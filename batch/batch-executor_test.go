@@ -0,0 +1,154 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestExecutor() Executor {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "dropped"})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"uri":    r.URL.RequestURI(),
+			"auth":   r.Header.Get("Authorization"),
+			"type":   r.Header.Get("Content-Type"),
+			"body":   string(body),
+		})
+	})
+	mux.HandleFunc("/api/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n"))
+	})
+	mux.HandleFunc("/api/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(strings.Repeat("x", 200))
+	})
+	mux.HandleFunc("/api/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/api/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"no such mehm"}`)
+	})
+
+	return NewExecutor(mux, Options{MaxRequests: 3, Concurrency: 2, MaxBodySize: 64, MaxResponseSize: 128})
+}
+
+func TestBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+		// wantBody is compared as JSON
+		wantBody string
+	}{
+		{
+			name:  "responses in order with the credentials of the batch",
+			input: `[{"id":"a","method":"GET","path":"/api/echo?n=1"},{"id":"b","method":"POST","path":"/api/echo","body":{"x":1}},{"path":"/api/missing"}]`,
+			want:  http.StatusOK,
+			wantBody: `[
+				{"id":"a","status":200,"header":{"Content-Type":"application/json"},"body":{"auth":"Bearer t0k3n","body":"","method":"GET","type":"","uri":"/api/echo?n=1"}},
+				{"id":"b","status":200,"header":{"Content-Type":"application/json"},"body":{"auth":"Bearer t0k3n","body":"{\"x\":1}","method":"POST","type":"application/json","uri":"/api/echo"}},
+				{"status":404,"header":{"Content-Type":"application/json"},"body":{"message":"no such mehm"}}
+			]`,
+		},
+		{
+			name:     "binary body",
+			input:    `[{"method":"GET","path":"/api/image"}]`,
+			want:     http.StatusOK,
+			wantBody: `[{"status":200,"header":{"Content-Type":"image/png"},"body":"iVBORw0K","encoding":"base64"}]`,
+		},
+		{
+			name:     "response too large",
+			input:    `[{"method":"GET","path":"/api/large"}]`,
+			want:     http.StatusOK,
+			wantBody: `[{"status":500,"header":{"Content-Type":"application/json"},"body":{"message":"response exceeds 128 bytes, send the request on its own"}}]`,
+		},
+		{
+			name:  "panicking request fails on its own",
+			input: `[{"method":"GET","path":"/api/panic"},{"method":"GET","path":"/api/image"}]`,
+			want:  http.StatusOK,
+			wantBody: `[
+				{"status":500,"header":{"Content-Type":"application/json"},"body":{"message":"request failed unexpectedly"}},
+				{"status":200,"header":{"Content-Type":"image/png"},"body":"iVBORw0K","encoding":"base64"}
+			]`,
+		},
+		{
+			name:  "paths outside the gateway",
+			input: `[{"method":"GET","path":"/api/batch"},{"method":"GET","path":"http://evil/api/echo"},{"method":"GET","path":"/api/../admin"}]`,
+			want:  http.StatusOK,
+			wantBody: `[
+				{"status":400,"header":{"Content-Type":"application/json"},"body":{"message":"batches cannot be nested"}},
+				{"status":400,"header":{"Content-Type":"application/json"},"body":{"message":"path http://evil/api/echo is no route of the gateway"}},
+				{"status":400,"header":{"Content-Type":"application/json"},"body":{"message":"path /api/../admin is no route of the gateway"}}
+			]`,
+		},
+		{
+			name:     "body too large",
+			input:    `[{"method":"POST","path":"/api/echo","body":{"text":"` + strings.Repeat("x", 64) + `"}}]`,
+			want:     http.StatusOK,
+			wantBody: `[{"status":413,"header":{"Content-Type":"application/json"},"body":{"message":"request body is too large"}}]`,
+		},
+		{
+			name:     "too many requests",
+			input:    `[{"path":"/api/echo"},{"path":"/api/echo"},{"path":"/api/echo"},{"path":"/api/echo"}]`,
+			want:     http.StatusUnprocessableEntity,
+			wantBody: `{"message":"a batch holds 1-3 requests"}`,
+		},
+		{
+			name:     "empty batch",
+			input:    `[]`,
+			want:     http.StatusUnprocessableEntity,
+			wantBody: `{"message":"a batch holds 1-3 requests"}`,
+		},
+		{
+			name:     "invalid request",
+			input:    `[{"method":"DELETE","path":"/api/echo"}]`,
+			want:     http.StatusUnprocessableEntity,
+			wantBody: `{"message":"invalid input","fields":[{"field":"[0].method","rule":"enum","message":"[0].method must be one of GET, POST"}]}`,
+		},
+		{
+			name:  "malformed batch",
+			input: `[{"path":`,
+			want:  http.StatusBadRequest,
+		},
+	}
+
+	executor := newTestExecutor()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(test.input))
+			r.Header.Set("Authorization", "Bearer t0k3n")
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			executor.Batch(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+			if test.wantBody == "" {
+				return
+			}
+			var got, want bytes.Buffer
+			if err := json.Compact(&got, w.Body.Bytes()); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body, err)
+			}
+			if err := json.Compact(&want, []byte(test.wantBody)); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("body =\n%s\nwant\n%s", got.String(), want.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nillga/mehm-services-api-gateway/batch"
+	"github.com/nillga/mehm-services-api-gateway/media"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds all settings of the gateway. Values are read from the file
+// named by CONFIG_FILE, if any, and environment variables take precedence.
+type Config struct {
+	Port      string `json:"port" yaml:"port" env:"PORT"`
+	Swagger   string `json:"swagger" yaml:"swagger" env:"SWAG"`
+	SecretKey string `json:"secretKey" yaml:"secretKey" env:"SECRET_KEY"`
+	UsersHost string `json:"usersHost" yaml:"usersHost" env:"USERS_HOST"`
+	MehmsHost string `json:"mehmsHost" yaml:"mehmsHost" env:"MEHMS_HOST"`
+	// PolicyFile holds the role-based access policy, the built-in policy is used without it.
+	PolicyFile string `json:"policyFile" yaml:"policyFile" env:"POLICY_FILE"`
+	// APIKeysFile persists the API keys of service clients, they are kept in memory only without it.
+	APIKeysFile string `json:"apiKeysFile" yaml:"apiKeysFile" env:"API_KEYS_FILE"`
+	// Genres are numbered by their position, new genres have to be appended.
+	Genres []string `json:"genres" yaml:"genres" env:"GENRES"`
+	// LegacyComments serves comments in the shape of dto.CommentDTO by default,
+	// for clients not migrated to dto.CommentV2 yet. Clients pick a shape per
+	// request with the shape query parameter.
+	LegacyComments bool `json:"legacyComments" yaml:"legacyComments" env:"LEGACY_COMMENTS"`
+	// MaxBodySize bounds JSON request bodies in bytes.
+	MaxBodySize int `json:"maxBodySize" yaml:"maxBodySize" env:"MAX_BODY_SIZE"`
+
+	JWT        JWT        `json:"jwt" yaml:"jwt"`
+	Auth       Auth       `json:"auth" yaml:"auth"`
+	Revocation Revocation `json:"revocation" yaml:"revocation"`
+	CORS       CORS       `json:"cors" yaml:"cors"`
+	Upstream   Upstream   `json:"upstream" yaml:"upstream"`
+	Lifecycle  Lifecycle  `json:"lifecycle" yaml:"lifecycle"`
+	Health     Health     `json:"health" yaml:"health"`
+	Upload     Upload     `json:"upload" yaml:"upload"`
+	Batch      Batch      `json:"batch" yaml:"batch"`
+	Directory  Directory  `json:"directory" yaml:"directory"`
+}
+
+type JWT struct {
+	// Algorithms lists the accepted signing methods. HMAC methods verify with
+	// SecretKey, RSA and ECDSA methods with the keys of the JWKS document.
+	Algorithms  []string `json:"algorithms" yaml:"algorithms" env:"JWT_ALGORITHMS"`
+	JWKSFile    string   `json:"jwksFile" yaml:"jwksFile" env:"JWKS_FILE"`
+	JWKSURL     string   `json:"jwksUrl" yaml:"jwksUrl" env:"JWKS_URL"`
+	JWKSRefresh Duration `json:"jwksRefresh" yaml:"jwksRefresh" env:"JWKS_REFRESH"`
+	// Issuer and Audience are enforced when set.
+	Issuer   string `json:"issuer" yaml:"issuer" env:"JWT_ISSUER"`
+	Audience string `json:"audience" yaml:"audience" env:"JWT_AUDIENCE"`
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway Duration `json:"leeway" yaml:"leeway" env:"JWT_LEEWAY"`
+}
+
+const (
+	// BearerAuth accepts tokens from the Authorization header only.
+	BearerAuth = "bearer"
+	// CookieAuth hands out and accepts tokens as HttpOnly cookie only.
+	CookieAuth = "cookie"
+	// MixedAuth prefers the Authorization header and falls back to the cookie.
+	MixedAuth = "both"
+)
+
+type Auth struct {
+	Mode         string `json:"mode" yaml:"mode" env:"AUTH_MODE"`
+	CookieName   string `json:"cookieName" yaml:"cookieName" env:"AUTH_COOKIE"`
+	CookieSecure bool   `json:"cookieSecure" yaml:"cookieSecure" env:"AUTH_COOKIE_SECURE"`
+	// CSRFCookieName and CSRFHeader name the double-submit token that POST
+	// requests authenticated by cookie have to repeat in the header.
+	CSRFCookieName string `json:"csrfCookieName" yaml:"csrfCookieName" env:"CSRF_COOKIE"`
+	CSRFHeader     string `json:"csrfHeader" yaml:"csrfHeader" env:"CSRF_HEADER"`
+}
+
+// Cookies reports whether tokens are handed out and accepted as cookie.
+func (a Auth) Cookies() bool {
+	return a.Mode == CookieAuth || a.Mode == MixedAuth
+}
+
+// Bearer reports whether tokens are accepted from the Authorization header.
+func (a Auth) Bearer() bool {
+	return a.Mode == BearerAuth || a.Mode == MixedAuth
+}
+
+type Revocation struct {
+	// File persists revocations, they are kept in memory only without it.
+	File string `json:"file" yaml:"file" env:"REVOCATION_FILE"`
+	// TokenLifetime is the longest lifetime of an issued token. Tokens without
+	// iat are taken to have been issued that long before they expire.
+	TokenLifetime Duration `json:"tokenLifetime" yaml:"tokenLifetime" env:"REVOCATION_TOKEN_LIFETIME"`
+}
+
+type CORS struct {
+	// AllowedOrigins defaults to all origins. Cookie authentication needs an explicit list.
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+type Upstream struct {
+	Timeout             Duration `json:"timeout" yaml:"timeout" env:"UPSTREAM_TIMEOUT"`
+	DialTimeout         Duration `json:"dialTimeout" yaml:"dialTimeout" env:"UPSTREAM_DIAL_TIMEOUT"`
+	MaxIdleConnsPerHost int      `json:"maxIdleConnsPerHost" yaml:"maxIdleConnsPerHost" env:"UPSTREAM_MAX_IDLE_CONNS_PER_HOST"`
+	MaxConnsPerHost     int      `json:"maxConnsPerHost" yaml:"maxConnsPerHost" env:"UPSTREAM_MAX_CONNS_PER_HOST"`
+
+	RetryAttempts    int      `json:"retryAttempts" yaml:"retryAttempts" env:"UPSTREAM_RETRY_ATTEMPTS"`
+	RetryBaseDelay   Duration `json:"retryBaseDelay" yaml:"retryBaseDelay" env:"UPSTREAM_RETRY_BASE_DELAY"`
+	RetryMaxDelay    Duration `json:"retryMaxDelay" yaml:"retryMaxDelay" env:"UPSTREAM_RETRY_MAX_DELAY"`
+	RetryBudgetRatio float64  `json:"retryBudgetRatio" yaml:"retryBudgetRatio" env:"UPSTREAM_RETRY_BUDGET_RATIO"`
+
+	BreakerFailureThreshold int      `json:"breakerFailureThreshold" yaml:"breakerFailureThreshold" env:"BREAKER_FAILURE_THRESHOLD"`
+	BreakerSuccessThreshold int      `json:"breakerSuccessThreshold" yaml:"breakerSuccessThreshold" env:"BREAKER_SUCCESS_THRESHOLD"`
+	BreakerCooldown         Duration `json:"breakerCooldown" yaml:"breakerCooldown" env:"BREAKER_COOLDOWN"`
+}
+
+type Lifecycle struct {
+	ShutdownTimeout Duration `json:"shutdownTimeout" yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	ReadinessDelay  Duration `json:"readinessDelay" yaml:"readinessDelay" env:"READINESS_DELAY"`
+}
+
+type Health struct {
+	Timeout  Duration `json:"timeout" yaml:"timeout" env:"HEALTH_TIMEOUT"`
+	CacheTTL Duration `json:"cacheTTL" yaml:"cacheTTL" env:"HEALTH_CACHE_TTL"`
+}
+
+type Upload struct {
+	// MaxImageSize is the largest accepted image in bytes.
+	MaxImageSize int `json:"maxImageSize" yaml:"maxImageSize" env:"UPLOAD_MAX_IMAGE_SIZE"`
+	// MaxWidth and MaxHeight bound the pixel dimensions of an image.
+	MaxWidth  int `json:"maxWidth" yaml:"maxWidth" env:"UPLOAD_MAX_WIDTH"`
+	MaxHeight int `json:"maxHeight" yaml:"maxHeight" env:"UPLOAD_MAX_HEIGHT"`
+	// MaxAnimationPixels bounds width times height times frames of an animated GIF.
+	MaxAnimationPixels int `json:"maxAnimationPixels" yaml:"maxAnimationPixels" env:"UPLOAD_MAX_ANIMATION_PIXELS"`
+	// ThumbnailWidths lists the widths of the thumbnails made of every image.
+	ThumbnailWidths []int `json:"thumbnailWidths" yaml:"thumbnailWidths" env:"UPLOAD_THUMBNAIL_WIDTHS"`
+	JPEGQuality     int   `json:"jpegQuality" yaml:"jpegQuality" env:"UPLOAD_JPEG_QUALITY"`
+	// ImageDir keeps the processed images, which are served below ImageURL.
+	ImageDir string `json:"imageDir" yaml:"imageDir" env:"IMAGE_DIR"`
+	ImageURL string `json:"imageURL" yaml:"imageURL" env:"IMAGE_URL"`
+}
+
+func (u Upload) MediaOptions() media.Options {
+	return media.Options{
+		MaxWidth:           u.MaxWidth,
+		MaxHeight:          u.MaxHeight,
+		MaxAnimationPixels: u.MaxAnimationPixels,
+		ThumbnailWidths:    u.ThumbnailWidths,
+		JPEGQuality:        u.JPEGQuality,
+	}
+}
+
+type Batch struct {
+	// MaxRequests bounds the requests of one batch, Concurrency the ones running at the same time.
+	MaxRequests int `json:"maxRequests" yaml:"maxRequests" env:"BATCH_MAX_REQUESTS"`
+	Concurrency int `json:"concurrency" yaml:"concurrency" env:"BATCH_CONCURRENCY"`
+	// MaxResponseSize bounds the response body of one request in bytes.
+	MaxResponseSize int `json:"maxResponseSize" yaml:"maxResponseSize" env:"BATCH_MAX_RESPONSE_SIZE"`
+}
+
+// Directory is the list of all users the authors of mehms and comments are
+// resolved from, since the users service cannot look up several users at once.
+type Directory struct {
+	// TTL is how long the list is reused before it is downloaded again.
+	TTL Duration `json:"ttl" yaml:"ttl" env:"DIRECTORY_TTL"`
+	// MaxSize bounds the list in bytes.
+	MaxSize int `json:"maxSize" yaml:"maxSize" env:"DIRECTORY_MAX_SIZE"`
+}
+
+// Duration accepts Go duration strings like "1m30s" in config files.
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(text))
+}
+
+func Default() *Config {
+	clientOptions := upstream.DefaultOptions()
+	retryOptions := upstream.DefaultRetryOptions()
+	breakerOptions := upstream.DefaultBreakerOptions()
+
+	return &Config{
+		Genres:      []string{"PROGRAMMING", "DHBW", "OTHER"},
+		MaxBodySize: 64 << 10,
+		JWT: JWT{
+			Algorithms:  []string{"HS256"},
+			JWKSRefresh: Duration(10 * time.Minute),
+		},
+		Auth: Auth{
+			Mode:           BearerAuth,
+			CookieName:     "jwt",
+			CookieSecure:   true,
+			CSRFCookieName: "csrf_token",
+			CSRFHeader:     "X-CSRF-Token",
+		},
+		Revocation: Revocation{
+			TokenLifetime: Duration(24 * time.Hour),
+		},
+		Upstream: Upstream{
+			Timeout:                 Duration(clientOptions.Timeout),
+			DialTimeout:             Duration(clientOptions.DialTimeout),
+			MaxIdleConnsPerHost:     clientOptions.MaxIdleConnsPerHost,
+			MaxConnsPerHost:         clientOptions.MaxConnsPerHost,
+			RetryAttempts:           retryOptions.MaxAttempts,
+			RetryBaseDelay:          Duration(retryOptions.BaseDelay),
+			RetryMaxDelay:           Duration(retryOptions.MaxDelay),
+			RetryBudgetRatio:        retryOptions.BudgetRatio,
+			BreakerFailureThreshold: breakerOptions.FailureThreshold,
+			BreakerSuccessThreshold: breakerOptions.SuccessThreshold,
+			BreakerCooldown:         Duration(breakerOptions.Cooldown),
+		},
+		Lifecycle: Lifecycle{
+			ShutdownTimeout: Duration(30 * time.Second),
+			ReadinessDelay:  Duration(5 * time.Second),
+		},
+		Health: Health{
+			Timeout:  Duration(2 * time.Second),
+			CacheTTL: Duration(5 * time.Second),
+		},
+		Upload: Upload{
+			MaxImageSize:       10 << 20,
+			MaxWidth:           4096,
+			MaxHeight:          4096,
+			MaxAnimationPixels: 64 << 20,
+			ThumbnailWidths:    []int{160, 480, 960},
+			JPEGQuality:        85,
+			ImageDir:           "images",
+			ImageURL:           "/api/images",
+		},
+		Batch: Batch{
+			MaxRequests:     20,
+			Concurrency:     4,
+			MaxResponseSize: 1 << 20,
+		},
+		Directory: Directory{
+			TTL:     Duration(time.Minute),
+			MaxSize: 64 << 20,
+		},
+	}
+}
+
+// Load reads the configuration and fails on missing or invalid values.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := readEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	var missing []string
+	if c.Port == "" {
+		missing = append(missing, "PORT")
+	}
+	if c.SecretKey == "" && c.usesAlgorithm("HS") {
+		missing = append(missing, "SECRET_KEY")
+	}
+	if c.JWT.JWKSFile == "" && c.JWT.JWKSURL == "" && (c.usesAlgorithm("RS") || c.usesAlgorithm("ES")) {
+		missing = append(missing, "JWKS_FILE or JWKS_URL")
+	}
+	if c.UsersHost == "" {
+		missing = append(missing, "USERS_HOST")
+	}
+	if c.MehmsHost == "" {
+		missing = append(missing, "MEHMS_HOST")
+	}
+	if c.Upload.ImageDir == "" {
+		missing = append(missing, "IMAGE_DIR")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+
+	switch c.Auth.Mode {
+	case BearerAuth, CookieAuth, MixedAuth:
+	default:
+		return fmt.Errorf("unknown auth mode %q", c.Auth.Mode)
+	}
+	if c.Auth.Cookies() && (c.Auth.CookieName == "" || c.Auth.CSRFCookieName == "" || c.Auth.CSRFHeader == "") {
+		return fmt.Errorf("cookie authentication needs cookie, CSRF cookie and CSRF header names")
+	}
+	if c.Auth.Cookies() {
+		// credentials are only sent cross-origin to the listed origins, not to all of them
+		if len(c.CORS.AllowedOrigins) == 0 {
+			return fmt.Errorf("cookie authentication needs CORS_ALLOWED_ORIGINS")
+		}
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				return fmt.Errorf("cookie authentication does not allow all CORS origins")
+			}
+		}
+	}
+	if len(c.JWT.Algorithms) == 0 {
+		return fmt.Errorf("at least one JWT algorithm must be allowed")
+	}
+	for _, alg := range c.JWT.Algorithms {
+		switch alg {
+		case "HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512":
+		default:
+			return fmt.Errorf("unsupported JWT algorithm %q", alg)
+		}
+	}
+	if c.Upstream.Timeout <= 0 {
+		return fmt.Errorf("upstream timeout must be positive")
+	}
+	if c.Upstream.RetryAttempts < 1 {
+		return fmt.Errorf("upstream retry attempts must be at least 1")
+	}
+	if c.Upstream.BreakerFailureThreshold < 1 {
+		return fmt.Errorf("breaker failure threshold must be at least 1")
+	}
+	if len(c.Genres) == 0 {
+		return fmt.Errorf("at least one genre is needed")
+	}
+	if c.MaxBodySize < 1 {
+		return fmt.Errorf("maximum body size must be positive")
+	}
+	if c.Upload.MaxImageSize < 1 || c.Upload.MaxWidth < 1 || c.Upload.MaxHeight < 1 || c.Upload.MaxAnimationPixels < 1 {
+		return fmt.Errorf("maximum image size and dimensions must be positive")
+	}
+	if c.Upload.JPEGQuality < 1 || c.Upload.JPEGQuality > 100 {
+		return fmt.Errorf("JPEG quality must be 1-100")
+	}
+	if c.Batch.MaxRequests < 1 || c.Batch.Concurrency < 1 || c.Batch.MaxResponseSize < 1 {
+		return fmt.Errorf("batch size, concurrency and response size must be positive")
+	}
+	if c.Directory.TTL <= 0 || c.Directory.MaxSize < 1 {
+		return fmt.Errorf("user directory TTL and size must be positive")
+	}
+
+	return nil
+}
+
+func (c *Config) usesAlgorithm(family string) bool {
+	for _, alg := range c.JWT.Algorithms {
+		if strings.HasPrefix(alg, family) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) ClientOptions() upstream.Options {
+	opts := upstream.DefaultOptions()
+	opts.Timeout = c.Upstream.Timeout.Duration()
+	opts.DialTimeout = c.Upstream.DialTimeout.Duration()
+	opts.MaxIdleConnsPerHost = c.Upstream.MaxIdleConnsPerHost
+	opts.MaxConnsPerHost = c.Upstream.MaxConnsPerHost
+	return opts
+}
+
+func (c *Config) RetryOptions() upstream.RetryOptions {
+	opts := upstream.DefaultRetryOptions()
+	opts.MaxAttempts = c.Upstream.RetryAttempts
+	opts.BaseDelay = c.Upstream.RetryBaseDelay.Duration()
+	opts.MaxDelay = c.Upstream.RetryMaxDelay.Duration()
+	opts.BudgetRatio = c.Upstream.RetryBudgetRatio
+	return opts
+}
+
+func (c *Config) BreakerOptions() upstream.BreakerOptions {
+	opts := upstream.DefaultBreakerOptions()
+	opts.FailureThreshold = c.Upstream.BreakerFailureThreshold
+	opts.SuccessThreshold = c.Upstream.BreakerSuccessThreshold
+	opts.Cooldown = c.Upstream.BreakerCooldown.Duration()
+	return opts
+}
+
+func (c *Config) BatchOptions() batch.Options {
+	return batch.Options{
+		MaxRequests:     c.Batch.MaxRequests,
+		Concurrency:     c.Batch.Concurrency,
+		MaxBodySize:     c.MaxBodySize,
+		MaxResponseSize: c.Batch.MaxResponseSize,
+	}
+}
+
+func (c *Config) readFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, c)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(file))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", file, err)
+	}
+	return nil
+}
+
+// readEnv overrides every field tagged with env whose variable is set.
+func readEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := readEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key := v.Type().Field(i).Tag.Get("env")
+		value, ok := os.LookupEnv(key)
+		if key == "" || !ok {
+			continue
+		}
+		if err := set(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func set(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(Duration(0)) {
+		return field.Addr().Interface().(*Duration).UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Slice:
+		items := reflect.Zero(field.Type())
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				elem := reflect.New(field.Type().Elem()).Elem()
+				if err := set(elem, item); err != nil {
+					return err
+				}
+				items = reflect.Append(items, elem)
+			}
+		}
+		field.Set(items)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
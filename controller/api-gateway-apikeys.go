@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+)
+
+type APIKeyController interface {
+	ListAPIKeys(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Security bearerToken
+// @Description  This is only usable for privileged users. Secrets are never listed.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  []apikey.Key{}
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Router       /admin/apikeys [get]
+func (c *controller) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	keys, err := c.apiKeys.List()
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	if err = json.NewEncoder(w).Encode(keys); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Security bearerToken
+// @Description  This is only usable for privileged users. Scopes are mehms:read, comments:post and admin. The secret is only returned once, send it as X-API-Key header.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        input   body      dto.APIKeyInput  true  "Input data"
+// @Success      200  {object}  dto.CreatedAPIKey{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
+// @Failure      500  {object}  errors.ProceduralError
+// @Router       /admin/apikeys [post]
+func (c *controller) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var input dto.APIKeyInput
+	if !c.decode(w, r, &input) {
+		return
+	}
+
+	key, secret, err := c.apiKeys.Create(input.Name, input.Scopes, user.Id)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err = json.NewEncoder(w).Encode(dto.CreatedAPIKey{Key: *key, Secret: secret}); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Security bearerToken
+// @Description  This is only usable for privileged users. The key is rejected from the next request on.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "The ID of the key"
+// @Success      200  {object}  interface{}
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
+// @Failure      404  {object}  errors.ProceduralError
+// @Router       /admin/apikeys/{id}/revoke [post]
+func (c *controller) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		utils.BadRequest(w, fmt.Errorf("key specification went wrong"))
+		return
+	}
+
+	if err := c.apiKeys.Revoke(id); err != nil {
+		utils.NotFound(w, err)
+	}
+}
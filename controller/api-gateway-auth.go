@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nillga/mehm-services-api-gateway/csrf"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+)
+
+type AuthController interface {
+	Login(w http.ResponseWriter, r *http.Request)
+	Signup(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	CSRFToken(w http.ResponseWriter, r *http.Request)
+}
+
+// tokenFields are the response fields the users service may hand out a token in.
+var tokenFields = []string{"token", "accessToken", "access_token", "jwt"}
+
+const maxAuthResponse = 1 << 20
+
+// Login godoc
+// @Summary      Log in
+// @Description  Proxied to the users service. If the gateway runs with auth cookies, the issued token is set as HttpOnly cookie instead of being returned.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input   body      entity.LoginInput  true  "Input data"
+// @Success      200  {object}  interface{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /auth/login [post]
+func (c *controller) Login(w http.ResponseWriter, r *http.Request) {
+	c.issue(w, r, "/login", nil)
+}
+
+// Signup godoc
+// @Summary      Sign up
+// @Description  Proxied to the users service. Tokens are handled like on login.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input   body      entity.SignupInput  true  "Input data"
+// @Success      200  {object}  interface{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /auth/signup [post]
+func (c *controller) Signup(w http.ResponseWriter, r *http.Request) {
+	c.issue(w, r, "/signup", nil)
+}
+
+// Refresh godoc
+// @Summary      Refresh a token
+// @Security bearerToken
+// @Description  Exchanges the current token, sent as bearer token or auth cookie, for a new one at the users service. Expired and revoked tokens are refused.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  interface{}
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /auth/refresh [post]
+func (c *controller) Refresh(w http.ResponseWriter, r *http.Request) {
+	token, err := c.service.TokenFromRequest(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		utils.Unauthorized(w, err)
+		return
+	}
+	if _, err = c.service.Verify(token); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		utils.Unauthorized(w, err)
+		return
+	}
+
+	c.issue(w, r, "/refresh", http.Header{"Authorization": {"Bearer " + token}})
+}
+
+// Logout godoc
+// @Summary      Log out
+// @Security bearerToken
+// @Description  Revokes the current token, clears the auth cookie and notifies the users service. Tokens without an id cannot be revoked one by one, so for them every token of the user issued so far is revoked, logging the user out on all devices.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  interface{}
+// @Failure      500  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /auth/logout [post]
+func (c *controller) Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if token, err := c.service.TokenFromRequest(r); err == nil {
+		if claims, err := c.service.Verify(token); err == nil {
+			if claims.StandardClaims.Id != "" {
+				err = c.service.RevokeToken(claims)
+			} else {
+				err = c.service.RevokeUser(claims.Id)
+			}
+			if err != nil {
+				utils.InternalServerError(w, fmt.Errorf("failed revoking token"))
+				return
+			}
+		}
+	}
+	if c.cfg.Auth.Cookies() {
+		http.SetCookie(w, c.authCookie("", time.Unix(0, 0)))
+		http.SetCookie(w, csrf.Cookie(c.cfg.Auth, "", time.Unix(0, 0)))
+	}
+
+	res, err := c.users.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/logout",
+	})
+	forward(w, res, err)
+}
+
+// CSRFToken godoc
+// @Summary      Issue a CSRF token
+// @Description  Sets a fresh CSRF cookie and returns its value. With cookie authentication, every POST request has to repeat it in the CSRF header.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Router       /auth/csrf [get]
+func (c *controller) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !c.cfg.Auth.Cookies() {
+		utils.NotFound(w, fmt.Errorf("cookie authentication is disabled"))
+		return
+	}
+
+	token, err := csrf.NewToken()
+	if err != nil {
+		utils.InternalServerError(w, err)
+		return
+	}
+	http.SetCookie(w, csrf.Cookie(c.cfg.Auth, token, time.Time{}))
+
+	if err = json.NewEncoder(w).Encode(map[string]string{"csrfToken": token}); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// issue proxies a call to the users service that may hand out a token. With
+// auth cookies enabled the token is moved from the response into the cookie.
+func (c *controller) issue(w http.ResponseWriter, r *http.Request, path string, header http.Header) {
+	w.Header().Set("Content-Type", "application/json")
+
+	res, err := c.users.Do(r.Context(), &upstream.Request{
+		Method: http.MethodPost,
+		Path:   path,
+		Body:   r.Body,
+		Header: header,
+	})
+	if err != nil || !c.cfg.Auth.Cookies() {
+		forward(w, res, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		utils.WrongStatus(w, res)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxAuthResponse))
+	if err != nil {
+		utils.BadGateway(w, err)
+		return
+	}
+
+	token, body := extractToken(res, body)
+	if token != "" {
+		claims, err := c.service.Verify(token)
+		if err != nil {
+			utils.BadGateway(w, fmt.Errorf("users service issued an unusable token: %v", err))
+			return
+		}
+
+		var expires time.Time
+		if claims.ExpiresAt != 0 {
+			expires = time.Unix(claims.ExpiresAt, 0)
+		}
+		csrfToken, err := csrf.NewToken()
+		if err != nil {
+			utils.InternalServerError(w, err)
+			return
+		}
+		http.SetCookie(w, c.authCookie(token, expires))
+		http.SetCookie(w, csrf.Cookie(c.cfg.Auth, csrfToken, expires))
+	}
+
+	w.Write(body)
+}
+
+func (c *controller) authCookie(token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.cfg.Auth.CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.cfg.Auth.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// extractToken finds a token in a JSON response body, an Authorization header
+// or a jwt cookie and returns the body without it.
+func extractToken(res *http.Response, body []byte) (string, []byte) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err == nil {
+		for _, field := range tokenFields {
+			if token, ok := document[field].(string); ok && token != "" {
+				delete(document, field)
+				stripped := bytes.NewBuffer([]byte{})
+				if err = json.NewEncoder(stripped).Encode(document); err != nil {
+					return token, []byte("{}\n")
+				}
+				return token, stripped.Bytes()
+			}
+		}
+	}
+
+	if header := res.Header.Get("Authorization"); len(header) > len("Bearer ") {
+		return header[len("Bearer "):], body
+	}
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "jwt" && cookie.Value != "" {
+			return cookie.Value, body
+		}
+	}
+	return "", body
+}
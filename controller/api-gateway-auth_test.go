@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/service"
+)
+
+type authFixture struct {
+	controller ApiGatewayController
+	service    *fakeService
+	users      *fakeBreaker
+}
+
+func newAuthFixture(t *testing.T, mode string, users http.HandlerFunc) *authFixture {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Auth.Mode = mode
+	accessPolicy, err := policy.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genres, err := dto.NewGenreRegistry(cfg.Genres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	fake := &fakeService{
+		auth: cfg.Auth,
+		claims: map[string]*service.Claims{
+			"with-jti":    {Id: "1", StandardClaims: jwt.StandardClaims{Id: "jti-1", ExpiresAt: expires}},
+			"without-jti": {Id: "2", StandardClaims: jwt.StandardClaims{ExpiresAt: expires}},
+			"revoked":     {Id: "3", StandardClaims: jwt.StandardClaims{Id: "jti-3", ExpiresAt: expires}},
+		},
+		revoked: map[string]bool{"revoked": true},
+	}
+	breaker := &fakeBreaker{handler: users}
+	return &authFixture{
+		controller: NewApiGatewayController(cfg, fake, accessPolicy, genres, breaker, &fakeBreaker{}, nil, nil),
+		service:    fake,
+		users:      breaker,
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		header string
+		cookie string
+		want   int
+		// wantToken is the token forwarded to the users service, if any
+		wantToken string
+	}{
+		{name: "without token", mode: config.BearerAuth, want: http.StatusUnauthorized},
+		{name: "invalid token", mode: config.BearerAuth, header: "forged", want: http.StatusUnauthorized},
+		{name: "revoked token", mode: config.BearerAuth, header: "revoked", want: http.StatusUnauthorized},
+		{name: "valid token", mode: config.BearerAuth, header: "with-jti", want: http.StatusOK, wantToken: "with-jti"},
+		{name: "bearer mode ignores the cookie", mode: config.BearerAuth, cookie: "with-jti", want: http.StatusUnauthorized},
+		{name: "cookie", mode: config.CookieAuth, cookie: "with-jti", want: http.StatusOK, wantToken: "with-jti"},
+		{name: "cookie mode ignores the header", mode: config.CookieAuth, header: "with-jti", want: http.StatusUnauthorized},
+		{name: "revoked cookie", mode: config.CookieAuth, cookie: "revoked", want: http.StatusUnauthorized},
+		{name: "header takes precedence over the cookie", mode: config.MixedAuth, header: "revoked", cookie: "with-jti", want: http.StatusUnauthorized},
+		{name: "cookie without header", mode: config.MixedAuth, cookie: "without-jti", want: http.StatusOK, wantToken: "without-jti"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newAuthFixture(t, test.mode, respond(`{"message":"refreshed"}`))
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", "Bearer "+test.header)
+			}
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "jwt", Value: test.cookie})
+			}
+			w := httptest.NewRecorder()
+			fixture.controller.Refresh(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+			if forwarded := len(fixture.users.requests) > 0; forwarded != (test.wantToken != "") {
+				t.Fatalf("forwarded = %t, want %t", forwarded, test.wantToken != "")
+			}
+			if test.wantToken == "" {
+				return
+			}
+			req := fixture.users.requests[0]
+			if req.Path != "/refresh" || req.Header.Get("Authorization") != "Bearer "+test.wantToken {
+				t.Errorf("forwarded %s with Authorization %q", req.Path, req.Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		token       string
+		cookie      bool
+		wantRevoked string
+		wantUser    string
+	}{
+		{name: "without token", mode: config.BearerAuth},
+		{name: "invalid token", mode: config.BearerAuth, token: "forged"},
+		{name: "token with id", mode: config.BearerAuth, token: "with-jti", wantRevoked: "with-jti"},
+		{name: "token without id", mode: config.BearerAuth, token: "without-jti", wantUser: "2"},
+		{name: "auth cookie", mode: config.CookieAuth, token: "with-jti", cookie: true, wantRevoked: "with-jti"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newAuthFixture(t, test.mode, respond(`{}`))
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+			switch {
+			case test.cookie:
+				r.AddCookie(&http.Cookie{Name: "jwt", Value: test.token})
+			case test.token != "":
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			fixture.controller.Logout(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if len(fixture.users.requests) != 1 || fixture.users.requests[0].Path != "/logout" {
+				t.Errorf("users service was not notified")
+			}
+			for token := range fixture.service.revoked {
+				if token != "revoked" && token != test.wantRevoked {
+					t.Errorf("revoked %s", token)
+				}
+			}
+			if test.wantRevoked != "" && !fixture.service.revoked[test.wantRevoked] {
+				t.Errorf("%s was not revoked", test.wantRevoked)
+			}
+			if revokedUsers := strings.Join(fixture.service.revokedUsers, ","); revokedUsers != test.wantUser {
+				t.Errorf("revoked users %q, want %q", revokedUsers, test.wantUser)
+			}
+
+			cleared := map[string]bool{}
+			for _, cookie := range w.Result().Cookies() {
+				cleared[cookie.Name] = cookie.Value == "" && cookie.Expires.Before(time.Now())
+			}
+			if test.mode == config.CookieAuth && !(cleared["jwt"] && cleared["csrf_token"]) {
+				t.Errorf("cookies were not cleared: %v", w.Result().Cookies())
+			}
+		})
+	}
+}
+
+func TestLoginCookies(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		upstream   string
+		wantCookie string
+		wantBody   string
+	}{
+		{name: "bearer mode hands out the token", mode: config.BearerAuth, upstream: `{"token":"with-jti"}`, wantBody: `{"token":"with-jti"}`},
+		{name: "cookie mode moves the token into a cookie", mode: config.CookieAuth, upstream: `{"token":"with-jti","name":"mehmer"}`, wantCookie: "with-jti", wantBody: `{"name":"mehmer"}`},
+		{name: "cookie mode without token", mode: config.CookieAuth, upstream: `{"message":"ok"}`, wantBody: `{"message":"ok"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newAuthFixture(t, test.mode, respond(test.upstream))
+			r := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"identifier":"mehmer","password":"secret"}`))
+			w := httptest.NewRecorder()
+			fixture.controller.Login(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+
+			cookies := map[string]*http.Cookie{}
+			for _, cookie := range w.Result().Cookies() {
+				cookies[cookie.Name] = cookie
+			}
+			if test.wantCookie == "" {
+				if len(cookies) > 0 {
+					t.Errorf("unexpected cookies %v", w.Result().Cookies())
+				}
+				return
+			}
+			if auth := cookies["jwt"]; auth == nil || auth.Value != test.wantCookie || !auth.HttpOnly {
+				t.Errorf("auth cookie = %v, want HttpOnly %s", auth, test.wantCookie)
+			}
+			if token := cookies["csrf_token"]; token == nil || token.Value == "" || token.HttpOnly {
+				t.Errorf("CSRF cookie = %v, want one readable by scripts", token)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+	"github.com/nillga/mehm-services-api-gateway/validation"
+)
+
+// The comment shapes a client may ask for with the shape query parameter.
+const (
+	shapeV2     = "v2"
+	shapeLegacy = "legacy"
+)
+
+// legacyComments tells whether the client asked for comments shaped like
+// dto.CommentDTO with ?shape=legacy or like dto.CommentV2 with ?shape=v2.
+// Without the parameter, LEGACY_COMMENTS decides.
+func (c *controller) legacyComments(r *http.Request) (bool, error) {
+	switch shape := r.URL.Query().Get("shape"); shape {
+	case "":
+		return c.cfg.LegacyComments, nil
+	case shapeLegacy:
+		return true, nil
+	case shapeV2:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown comment shape %q, use %s or %s", shape, shapeV2, shapeLegacy)
+	}
+}
+
+// forwardComment relays the comment id of the mehms service in the requested shape.
+func (c *controller) forwardComment(w http.ResponseWriter, res *http.Response, err error, id string, legacy bool) {
+	if err != nil || res.StatusCode != http.StatusOK {
+		forward(w, res, err)
+		return
+	}
+	defer res.Body.Close()
+
+	comment, err := readComment(res.Body, id)
+	if err != nil {
+		utils.BadGateway(w, fmt.Errorf("invalid comment from mehms service: %w", err))
+		return
+	}
+
+	var out interface{} = comment
+	if legacy {
+		out = comment.Legacy()
+	}
+	if err = json.NewEncoder(w).Encode(out); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// readComment reads a comment the way the mehms service sends it, shaped like
+// dto.CommentDTO, and addresses it by the id it was requested with.
+func readComment(body io.Reader, id string) (dto.CommentV2, error) {
+	var legacy dto.CommentDTO
+	if err := json.NewDecoder(io.LimitReader(body, maxMehmResponse)).Decode(&legacy); err != nil {
+		return dto.CommentV2{}, err
+	}
+	comment := legacy.V2()
+	comment.Id = parseId(id)
+	return comment, nil
+}
+
+// parseId reads the id of a resource the mehms service found, which is a
+// number. Others are left zero.
+func parseId(id string) int64 {
+	number, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// shapeComments renders comments in the requested shape.
+func shapeComments(comments []dto.CommentV2, legacy bool) interface{} {
+	if !legacy {
+		return comments
+	}
+	shaped := make([]dto.CommentDTO, len(comments))
+	for i, comment := range comments {
+		shaped[i] = comment.Legacy()
+	}
+	return shaped
+}
+
+// GetMehmComments godoc
+// @Summary      Read the comments of a mehm
+// @Security bearerToken
+// @Security apiKey
+// @Description  Comments are paged by skip and take and shaped like dto.CommentV2 or, with shape=legacy, like dto.CommentDTO. Without shape, the gateway's default applies. X-Total-Count holds the number of all comments of the mehm if the mehms service tells it, the Link header points to the neighbouring pages.
+// @Tags         comments
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int     true   "The ID of the mehm" minimum(1)
+// @Param        skip   query     int     false  "states the number of skipped comments" minimum(0) default(0)
+// @Param        take   query     int     false  "states the count of grabbed comments" minimum(1) maximum(50) default(20)
+// @Param        sort   query     string  false  "sort by creation, oldest first or with - newest first" Enums(createdDate, -createdDate) default(createdDate)
+// @Param        shape  query     string  false  "the shape of the comments" Enums(v2, legacy)
+// @Success      200  {object}  []dto.CommentV2{}
+// @Header       200  {int}     X-Total-Count  "number of all comments of the mehm"
+// @Header       200  {string}  Link           "URLs of the next and previous page"
+// @Failure      400  {object}  validation.Error
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /mehms/{id}/comments [get]
+func (c *controller) GetMehmComments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		utils.BadRequest(w, fmt.Errorf("mehm specification went wrong"))
+		return
+	}
+	legacy, err := c.legacyComments(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+	query := dto.NewCommentQuery()
+	if err := validation.DecodeQuery(r.URL.Query(), &query, nil); err != nil {
+		var invalid *validation.Error
+		if errors.As(err, &invalid) {
+			utils.InvalidInput(w, http.StatusBadRequest, invalid)
+			return
+		}
+		utils.InternalServerError(w, err)
+		return
+	}
+
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms/" + url.PathEscape(id) + "/comments",
+		Query:  query.Values(),
+	})
+	if err != nil || res.StatusCode != http.StatusOK {
+		forward(w, res, err)
+		return
+	}
+	defer res.Body.Close()
+
+	page, total, err := readCommentPage(res, id)
+	if err != nil {
+		utils.BadGateway(w, fmt.Errorf("invalid comments from mehms service: %w", err))
+		return
+	}
+	comments := shapeComments(page, legacy)
+
+	if total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+	if link := pageLinks(r.URL, query, len(page), total); link != "" {
+		w.Header().Set("Link", link)
+	}
+	if err = json.NewEncoder(w).Encode(comments); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+// readCommentPage reads a page of comments of the mehm mehmId the way the
+// mehms service sends it, like GET /mehms/{id}/comments of the gateway: a
+// plain list of comments shaped like dto.CommentDTO with the number of all
+// comments in the X-Total-Count header. total is -1 if the header is missing.
+func readCommentPage(res *http.Response, mehmId string) ([]dto.CommentV2, int, error) {
+	total := -1
+	if header := res.Header.Get("X-Total-Count"); header != "" {
+		var err error
+		if total, err = strconv.Atoi(header); err != nil {
+			return nil, -1, fmt.Errorf("X-Total-Count: %w", err)
+		}
+	}
+
+	var legacy []dto.CommentDTO
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxMehmResponse)).Decode(&legacy); err != nil {
+		return nil, -1, err
+	}
+	page := make([]dto.CommentV2, len(legacy))
+	for i, comment := range legacy {
+		page[i] = comment.V2()
+		page[i].MehmId = parseId(mehmId)
+	}
+	return page, total, nil
+}
+
+// pageLinks renders an RFC 8288 Link header for the pages around the current one.
+func pageLinks(current *url.URL, query dto.CommentQuery, count, total int) string {
+	link := func(skip int, rel string) string {
+		values := query.Values()
+		values.Set("skip", strconv.Itoa(skip))
+		if shape := current.Query().Get("shape"); shape != "" {
+			values.Set("shape", shape)
+		}
+		page := url.URL{Path: current.Path, RawQuery: values.Encode()}
+		return fmt.Sprintf(`<%s>; rel="%s"`, page.String(), rel)
+	}
+
+	var links []string
+	if query.Skip > 0 {
+		previous := query.Skip - query.Take
+		if previous < 0 {
+			previous = 0
+		}
+		links = append(links, link(previous, "prev"))
+	}
+	if (total >= 0 && query.Skip+count < total) || (total < 0 && count == query.Take) {
+		links = append(links, link(query.Skip+query.Take, "next"))
+	}
+	return strings.Join(links, ", ")
+}
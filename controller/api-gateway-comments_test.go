@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/mehm-services-api-gateway/config"
+)
+
+// legacyComment is a comment the way the mehms service sends it, with the text under "id".
+const legacyComment = `{"id":"nice mehm","author":"alice","dateTime":"2026-01-02T03:04:05Z"}`
+
+func TestGetComment(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		legacyDefault  bool
+		upstream       http.HandlerFunc
+		wantStatus     int
+		wantBody       string
+		wantBodyPrefix string
+	}{
+		{
+			name:       "v2 from a legacy comment",
+			upstream:   respond(legacyComment),
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":7,"mehmId":0,"authorId":"","authorName":"alice","text":"nice mehm","createdAt":"2026-01-02T03:04:05Z","editedAt":null}`,
+		},
+		{
+			name:       "legacy on request",
+			query:      "?shape=legacy",
+			upstream:   respond(legacyComment),
+			wantStatus: http.StatusOK,
+			wantBody:   legacyComment,
+		},
+		{
+			name:          "legacy by default",
+			legacyDefault: true,
+			upstream:      respond(legacyComment),
+			wantStatus:    http.StatusOK,
+			wantBody:      legacyComment,
+		},
+		{
+			name:          "v2 on request",
+			query:         "?shape=v2",
+			legacyDefault: true,
+			upstream:      respond(legacyComment),
+			wantStatus:    http.StatusOK,
+			wantBody:      `{"id":7,"mehmId":0,"authorId":"","authorName":"alice","text":"nice mehm","createdAt":"2026-01-02T03:04:05Z","editedAt":null}`,
+		},
+		{
+			name:       "unknown shape",
+			query:      "?shape=v3",
+			upstream:   respond(legacyComment),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "upstream error is forwarded",
+			upstream: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"message":"comment not found"}`, http.StatusNotFound)
+			},
+			wantStatus:     http.StatusNotFound,
+			wantBodyPrefix: `{"message":"comment not found"}`,
+		},
+		{
+			name:           "invalid comment",
+			upstream:       respond(`["nice mehm"]`),
+			wantStatus:     http.StatusBadGateway,
+			wantBodyPrefix: `{"message":"invalid comment from mehms service`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.LegacyComments = test.legacyDefault
+			mehms := &fakeBreaker{handler: test.upstream}
+			c := newMehmsController(t, cfg, &fakeBreaker{}, mehms)
+
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/comments/7"+test.query, nil), map[string]string{"id": "7"})
+			w := httptest.NewRecorder()
+			c.GetComment(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			body := strings.TrimSpace(w.Body.String())
+			if test.wantBody != "" && body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+			if !strings.HasPrefix(body, test.wantBodyPrefix) {
+				t.Errorf("body = %s, want it to start with %s", body, test.wantBodyPrefix)
+			}
+			if test.wantStatus != http.StatusBadRequest && (len(mehms.requests) != 1 || mehms.requests[0].Path != "/comments/get/7") {
+				t.Errorf("upstream requests = %v, want /comments/get/7", mehms.requests)
+			}
+		})
+	}
+}
+
+// commentPage answers like the mehms service with a page of legacy comments
+// and, unless total is empty, the number of all comments.
+func commentPage(total string, comments ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if total != "" {
+			w.Header().Set("X-Total-Count", total)
+		}
+		respond("["+strings.Join(comments, ",")+"]")(w, r)
+	}
+}
+
+func TestGetMehmComments(t *testing.T) {
+	second := `{"id":"great mehm","author":"bob","dateTime":"2026-01-03T03:04:05Z"}`
+	v2 := `[{"id":0,"mehmId":5,"authorId":"","authorName":"alice","text":"nice mehm","createdAt":"2026-01-02T03:04:05Z","editedAt":null},` +
+		`{"id":0,"mehmId":5,"authorId":"","authorName":"bob","text":"great mehm","createdAt":"2026-01-03T03:04:05Z","editedAt":null}]`
+
+	tests := []struct {
+		name       string
+		query      string
+		upstream   http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantTotal  string
+		wantLink   string
+	}{
+		{
+			name:       "first page",
+			query:      "?take=2",
+			upstream:   commentPage("5", legacyComment, second),
+			wantStatus: http.StatusOK,
+			wantBody:   v2,
+			wantTotal:  "5",
+			wantLink:   `</api/mehms/5/comments?skip=2&sort=createdDate&take=2>; rel="next"`,
+		},
+		{
+			name:       "legacy page in the middle",
+			query:      "?skip=2&take=2&shape=legacy",
+			upstream:   commentPage("5", legacyComment, second),
+			wantStatus: http.StatusOK,
+			wantBody:   "[" + legacyComment + "," + second + "]",
+			wantTotal:  "5",
+			wantLink: `</api/mehms/5/comments?shape=legacy&skip=0&sort=createdDate&take=2>; rel="prev", ` +
+				`</api/mehms/5/comments?shape=legacy&skip=4&sort=createdDate&take=2>; rel="next"`,
+		},
+		{
+			name:       "last page without total",
+			query:      "?take=3",
+			upstream:   commentPage("", legacyComment, second),
+			wantStatus: http.StatusOK,
+			wantBody:   v2,
+		},
+		{
+			name:       "full page without total",
+			query:      "?take=2",
+			upstream:   commentPage("", legacyComment, second),
+			wantStatus: http.StatusOK,
+			wantBody:   v2,
+			wantLink:   `</api/mehms/5/comments?skip=2&sort=createdDate&take=2>; rel="next"`,
+		},
+		{name: "invalid total", upstream: commentPage("many", legacyComment), wantStatus: http.StatusBadGateway},
+		{name: "no list", upstream: respond(legacyComment), wantStatus: http.StatusBadGateway},
+		{name: "invalid query", query: "?take=51", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mehms := &fakeBreaker{handler: test.upstream}
+			c := newMehmsController(t, config.Default(), &fakeBreaker{}, mehms)
+
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/mehms/5/comments"+test.query, nil), map[string]string{"id": "5"})
+			w := httptest.NewRecorder()
+			c.GetMehmComments(w, r)
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+			if total := w.Header().Get("X-Total-Count"); total != test.wantTotal {
+				t.Errorf("X-Total-Count = %q, want %q", total, test.wantTotal)
+			}
+			if link := w.Header().Get("Link"); link != test.wantLink {
+				t.Errorf("Link = %s, want %s", link, test.wantLink)
+			}
+		})
+	}
+}
@@ -2,24 +2,39 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
-	"os"
+	"net/url"
+	"reflect"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/graph-gophers/graphql-go"
 	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/config"
 	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/media"
+	"github.com/nillga/mehm-services-api-gateway/policy"
 	"github.com/nillga/mehm-services-api-gateway/service"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
 	"github.com/nillga/mehm-services-api-gateway/utils"
+	"github.com/nillga/mehm-services-api-gateway/validation"
 )
 
 type ReadController interface {
+	Genres(w http.ResponseWriter, r *http.Request)
 	GetAllMehms(w http.ResponseWriter, r *http.Request)
 	GetSpecificMehm(w http.ResponseWriter, r *http.Request)
+	GetMehmDetail(w http.ResponseWriter, r *http.Request)
 	GetComment(w http.ResponseWriter, r *http.Request)
+	GetMehmComments(w http.ResponseWriter, r *http.Request)
 }
 
 type UserController interface {
@@ -36,27 +51,147 @@ type PrivilegedController interface {
 	AllUsers(w http.ResponseWriter, r *http.Request)
 	ToggleElevation(w http.ResponseWriter, r *http.Request)
 	DeleteComment(w http.ResponseWriter, r *http.Request)
+	UpstreamStatus(w http.ResponseWriter, r *http.Request)
 }
 
 type ApiGatewayController interface {
+	AuthController
+	APIKeyController
+	UploadController
+	GraphQLController
 	ReadController
 	UserController
 	PrivilegedController
 }
 
 type controller struct {
+	cfg     *config.Config
+	service service.ApiGatewayService
+	policy  policy.Policy
+	genres  dto.GenreRegistry
+	users   upstream.Breaker
+	mehms   upstream.Breaker
+	apiKeys apikey.Store
+	images  media.Store
+	schema  *graphql.Schema
+	// directory caches the users authors are resolved from.
+	directory userDirectory
+	// queryParsers parse the query parameters naming genres.
+	queryParsers validation.Parsers
 }
 
-var apiGatewayService = service.NewApiGatewayService()
-var users = os.Getenv("USERS_HOST")
-var mehms = os.Getenv("MEHMS_HOST")
+func NewApiGatewayController(cfg *config.Config, apiGatewayService service.ApiGatewayService, accessPolicy policy.Policy, genres dto.GenreRegistry, users, mehms upstream.Breaker, apiKeys apikey.Store, images media.Store) ApiGatewayController {
+	c := &controller{
+		cfg:     cfg,
+		service: apiGatewayService,
+		policy:  accessPolicy,
+		genres:  genres,
+		users:   users,
+		mehms:   mehms,
+		apiKeys: apiKeys,
+		images:  images,
+	}
+	c.queryParsers = validation.Parsers{
+		reflect.TypeOf(dto.Genre{}): func(text string) (interface{}, error) {
+			return genres.Parse(text)
+		},
+	}
+	c.schema = graphql.MustParseSchema(schema, &graphResolver{c}, graphql.MaxDepth(maxQueryDepth))
+	return c
+}
+
+// privileged renders the isAdmin flag the mehms service expects: whether the
+// user may act on other people's resources, not only on their own.
+func (c *controller) privileged(user *entity.User, permission policy.Permission) string {
+	return strconv.FormatBool(c.policy.Scope(user, permission) == policy.Any)
+}
+
+// currentUser returns the user the router authenticated for this request.
+func currentUser(w http.ResponseWriter, r *http.Request) (*entity.User, bool) {
+	user, ok := service.UserFromContext(r.Context())
+	if !ok {
+		utils.Unauthorized(w, fmt.Errorf("unauthenticated"))
+	}
+	return user, ok
+}
+
+// revokeOnSuccess invalidates the tokens of a user whose account the upstream
+// call changed, so stale claims like admin cannot be used until expiry.
+func (c *controller) revokeOnSuccess(res *http.Response, err error, userId string) {
+	if err != nil || res.StatusCode != http.StatusOK {
+		return
+	}
+	if err = c.service.RevokeUser(userId); err != nil {
+		log.Printf("failed revoking tokens of user %s: %v", userId, err)
+	}
+}
 
-func NewApiGatewayController() ApiGatewayController {
-	return &controller{}
+// decode reads and validates a JSON request body. If that fails, the request is answered and false returned.
+func (c *controller) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := validation.Decode(r, v, int64(c.cfg.MaxBodySize))
+	var invalid *validation.Error
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		utils.InvalidInput(w, http.StatusUnprocessableEntity, invalid)
+	case errors.Is(err, validation.ErrBodyTooLarge):
+		utils.RequestEntityTooLarge(w, err)
+	default:
+		utils.BadRequest(w, err)
+	}
+	return false
+}
+
+// forward relays the upstream response to the client and releases its body.
+func forward(w http.ResponseWriter, res *http.Response, err error) {
+	if err != nil {
+		upstreamError(w, err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		utils.WrongStatus(w, res)
+		return
+	}
+
+	if _, err = io.Copy(w, res.Body); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
+
+func upstreamError(w http.ResponseWriter, err error) {
+	var openErr *upstream.OpenCircuitError
+	if errors.As(err, &openErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(openErr.RetryAfterSeconds()))
+	}
+	switch upstreamStatus(err) {
+	case http.StatusServiceUnavailable:
+		utils.ServiceUnavailable(w, err)
+	case http.StatusGatewayTimeout:
+		utils.GatewayTimeout(w, err)
+	default:
+		utils.BadGateway(w, err)
+	}
+}
+
+// upstreamStatus tells the status a failed upstream call is answered with.
+func upstreamStatus(err error) int {
+	var openErr *upstream.OpenCircuitError
+	if errors.As(err, &openErr) {
+		return http.StatusServiceUnavailable
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
 }
 
 // GetMehms godoc
 // @Security bearerToken
+// @Security apiKey
 // @Summary      Read a page of mehms
 // @Description  Pagination can be handled via query parameters
 // @Tags         mehms
@@ -65,42 +200,44 @@ func NewApiGatewayController() ApiGatewayController {
 // @Param        skip   query      int  false  "states the number of skipped Mehms" minimum(0) default(0)
 // @Param        take   query      int  false  "states the count of grabbed Mehms" minimum(1) maximum(30) default(30)
 // @Param        textSearch   query      string  false  "search a Mehm by name" minlength(0) maxlength(32) default()
-// @Param        genre   query      string  false  "filter for a genre" Enums(PROGRAMMING, DHBW, OTHER, )
+// @Param        genre   query      string  false  "filter for a genre by name, GET /genres lists them"
 // @Param        sort   query      string  false  "sort the results" Enums(createdDate, likes)
 // @Success      200  {object}  map[string]dto.MehmDTO{}
-// @Failure      400  {object}  errors.ProceduralError
+// @Failure      400  {object}  validation.Error
 // @Failure      401  {object}  errors.ProceduralError
 // @Failure      500  {object}  errors.ProceduralError
 // @Router       /mehms [get]
 func (c *controller) GetAllMehms(w http.ResponseWriter, r *http.Request) {
-	_, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	if r.URL.Query().Get("genre") != "" && r.URL.Query().Get("genre") != "PROGRAMMING" && r.URL.Query().Get("genre") != "DHBW" && r.URL.Query().Get("genre") != "OTHER" {
-		utils.BadRequest(w, fmt.Errorf("invalid genre %s", r.URL.Query().Get("genre")))
-		return
-	}
-
-	pr, err := http.NewRequest(r.Method, mehms+"/mehms?"+r.URL.Query().Encode(), r.Body)
-	if err != nil {
+	query := dto.NewFeedQuery()
+	if err := validation.DecodeQuery(r.URL.Query(), &query, c.queryParsers); err != nil {
+		var invalid *validation.Error
+		if errors.As(err, &invalid) {
+			utils.InvalidInput(w, http.StatusBadRequest, invalid)
+			return
+		}
 		utils.InternalServerError(w, err)
 		return
 	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
 
-	if _, err = io.Copy(w, res.Body); err != nil {
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms",
+		Query:  query.Values(),
+	})
+	c.forwardMehms(w, res, err)
+}
+
+// Genres godoc
+// @Summary      List the genres
+// @Description  Genres are sent by name, the number is the one the mehms service stores.
+// @Tags         mehms
+// @Produce      json
+// @Success      200  {object}  []dto.GenreDTO{}
+// @Router       /genres [get]
+func (c *controller) Genres(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c.genres.Genres()); err != nil {
 		utils.InternalServerError(w, err)
 	}
 }
@@ -108,6 +245,7 @@ func (c *controller) GetAllMehms(w http.ResponseWriter, r *http.Request) {
 // GetSpecificMehm godoc
 // @Summary      View a specified mehm
 // @Security bearerToken
+// @Security apiKey
 // @Description  This will return the requested Mehm including the information whether you have liked it already.
 // @Tags         mehms
 // @Accept       json
@@ -120,9 +258,8 @@ func (c *controller) GetAllMehms(w http.ResponseWriter, r *http.Request) {
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /mehms/{id} [get]
 func (c *controller) GetSpecificMehm(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -134,72 +271,49 @@ func (c *controller) GetSpecificMehm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, mehms+"/mehms/get/"+id+"?userId="+user.Id, r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms/get/" + url.PathEscape(id),
+		Query:  url.Values{"userId": {user.Id}},
+	})
+	c.forwardMehms(w, res, err)
 }
 
 // GetComment godoc
 // @Summary      Read a specified comment
 // @Security bearerToken
-// @Description  By specifying the comment id, you can read that comment
+// @Security apiKey
+// @Description  By specifying the comment id, you can read that comment. With shape=legacy, or by default on gateways running with LEGACY_COMMENTS, it is shaped like dto.CommentDTO instead.
 // @Tags         comments
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int  true  "The ID of the requested comment" minimum(1)
-// @Success      200  {object}  dto.CommentDTO{}
+// @Param        id     path      int     true   "The ID of the requested comment" minimum(1)
+// @Param        shape  query     string  false  "the shape of the comment" Enums(v2, legacy)
+// @Success      200  {object}  dto.CommentV2{}
 // @Failure      400  {object}  errors.ProceduralError
 // @Failure      401  {object}  errors.ProceduralError
 // @Failure      500  {object}  errors.ProceduralError
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /comments/get/{id} [get]
 func (c *controller) GetComment(w http.ResponseWriter, r *http.Request) {
-	_, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
-		return
-	}
-
+	w.Header().Set("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
 	if !ok {
 		utils.BadRequest(w, fmt.Errorf("comment specification went wrong"))
 		return
 	}
-
-	pr, err := http.NewRequest("GET", mehms+"/comments/get/"+id, r.Body)
+	legacy, err := c.legacyComments(r)
 	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
+		utils.BadRequest(w, err)
 		return
 	}
 
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/comments/get/" + url.PathEscape(id),
+	})
+	c.forwardComment(w, res, err, id, legacy)
 }
 
 // ResolveProfile godoc
@@ -214,13 +328,12 @@ func (c *controller) GetComment(w http.ResponseWriter, r *http.Request) {
 // @Failure      500  {object}  errors.ProceduralError
 // @Router       /user [get]
 func (c *controller) ResolveProfile(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
-	if err = json.NewEncoder(w).Encode(user); err != nil {
+	if err := json.NewEncoder(w).Encode(user); err != nil {
 		utils.InternalServerError(w, err)
 		return
 	}
@@ -236,39 +349,17 @@ func (c *controller) ResolveProfile(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Success      200  {object}  []entity.User{}
 // @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
 // @Failure      500  {object}  errors.ProceduralError
 // @Router       /user/all [get]
 func (c *controller) AllUsers(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
-		return
-	}
-	if !user.Admin {
-		utils.Forbidden(w, fmt.Errorf("admin-only"))
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 
-	pr, err := http.NewRequest(r.Method, users+"/all", r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.users.Do(r.Context(), &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/all",
+	})
+	forward(w, res, err)
 }
 
 // ToggleElevation godoc
@@ -281,19 +372,10 @@ func (c *controller) AllUsers(w http.ResponseWriter, r *http.Request) {
 // @Param        id   query      int  true  "The ID of the user" minimum(1)
 // @Success      200  {object}  []entity.User{}
 // @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
 // @Failure      500  {object}  errors.ProceduralError
 // @Router       /user/elevate [get]
 func (c *controller) ToggleElevation(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
-		return
-	}
-	if !user.Admin {
-		utils.Forbidden(w, fmt.Errorf("admin-only"))
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 
 	if id, err := strconv.Atoi(r.URL.Query().Get("id")); err != nil || id < 1 {
@@ -301,19 +383,14 @@ func (c *controller) ToggleElevation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, users+"/elevate?id="+r.URL.Query().Get("id"), r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-	}
+	res, err := c.users.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/elevate",
+		Query:  url.Values{"id": {r.URL.Query().Get("id")}},
+		Body:   r.Body,
+	})
+	c.revokeOnSuccess(res, err, r.URL.Query().Get("id"))
+	forward(w, res, err)
 }
 
 // LikeMehm godoc
@@ -331,9 +408,8 @@ func (c *controller) ToggleElevation(w http.ResponseWriter, r *http.Request) {
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /mehms/{id}/like [post]
 func (c *controller) LikeMehm(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -345,30 +421,19 @@ func (c *controller) LikeMehm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, mehms+"/mehms/"+id+"/like?userId="+user.Id, r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/mehms/" + url.PathEscape(id) + "/like",
+		Query:  url.Values{"userId": {user.Id}},
+		Body:   r.Body,
+	})
+	forward(w, res, err)
 }
 
 // PostComment godoc
 // @Summary      Post a comment
 // @Security bearerToken
+// @Security apiKey
 // @Description  With this API-Call you are able to post a comment related to any existing Mehm.
 // @Tags         comments
 // @Accept       json
@@ -377,57 +442,37 @@ func (c *controller) LikeMehm(w http.ResponseWriter, r *http.Request) {
 // @Success      200  {object}  interface{}
 // @Failure      400  {object}  errors.ProceduralError
 // @Failure      401  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
 // @Failure      500  {object}  errors.ProceduralError
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /comments/new [post]
 func (c *controller) PostComment(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	var comment dto.Comment
-	if err = json.NewDecoder(r.Body).Decode(&comment); err != nil {
-		utils.BadRequest(w, err)
-		return
-	}
-	if comment.MehmId < 1 {
-		utils.NotFound(w, fmt.Errorf("index %d does not exist", comment.MehmId))
-		return
-	}
-	if comment.Comment == "" || len(comment.Comment) > 256 {
-		utils.UnprocessableEntity(w, fmt.Errorf("comment must be 1-256 signs"))
+	if !c.decode(w, r, &comment) {
 		return
 	}
 
 	body := bytes.NewBuffer([]byte{})
 
-	if err = json.NewEncoder(body).Encode(comment); err != nil {
+	if err := json.NewEncoder(body).Encode(comment); err != nil {
 		utils.InternalServerError(w, fmt.Errorf("failed repeating request"))
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, mehms+"/comments/new?userId="+user.Id, body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	pr.Header.Add("Content-Type", "application/json")
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/comments/new",
+		Query:  url.Values{"userId": {user.Id}},
+		Body:   body,
+	})
+	forward(w, res, err)
 }
 
 // EditComment godoc
@@ -442,52 +487,38 @@ func (c *controller) PostComment(w http.ResponseWriter, r *http.Request) {
 // @Failure      400  {object}  errors.ProceduralError
 // @Failure      401  {object}  errors.ProceduralError
 // @Failure      403  {object}  errors.ProceduralError
-// @Failure      422  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
 // @Failure      500  {object}  errors.ProceduralError
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /comments/update [post]
 func (c *controller) EditComment(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	var input dto.CommentInput
-
-	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.UnprocessableEntity(w, fmt.Errorf("format problems"))
+	if !c.decode(w, r, &input) {
 		return
 	}
 
-	admin := strconv.FormatBool(user.Admin)
+	admin := c.privileged(user, policy.EditComments)
 
 	body := bytes.NewBuffer([]byte{})
 
-	if err = json.NewEncoder(body).Encode(input); err != nil {
+	if err := json.NewEncoder(body).Encode(input); err != nil {
 		utils.InternalServerError(w, fmt.Errorf("failed repeating request"))
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, mehms+"/comments/update?userId="+user.Id+"&isAdmin="+admin, body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	pr.Header.Add("Content-Type", "application/json")
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/comments/update",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {admin}},
+		Body:   body,
+	})
+	forward(w, res, err)
 }
 
 // EditMehm godoc
@@ -504,7 +535,8 @@ func (c *controller) EditComment(w http.ResponseWriter, r *http.Request) {
 // @Failure      400  {object}  errors.ProceduralError
 // @Failure      401  {object}  errors.ProceduralError
 // @Failure      403  {object}  errors.ProceduralError
-// @Failure      422  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
 // @Failure      500  {object}  errors.ProceduralError
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /mehms/{id}/update [post]
@@ -516,47 +548,29 @@ func (c *controller) EditMehm(w http.ResponseWriter, r *http.Request) {
 		utils.BadRequest(w, fmt.Errorf("mehm specification went wrong"))
 		return
 	}
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
-		return
-	}
-	if !user.Admin {
-		utils.Forbidden(w, fmt.Errorf("not authorized"))
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 	var input dto.MehmInput
-
-	if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.UnprocessableEntity(w, fmt.Errorf("format problems"))
+	if !c.decode(w, r, &input) {
 		return
 	}
-	admin := strconv.FormatBool(user.Admin)
+	admin := c.privileged(user, policy.EditMehms)
 
 	body := bytes.NewBuffer([]byte{})
 
-	if err = json.NewEncoder(body).Encode(input); err != nil {
+	if err := json.NewEncoder(body).Encode(input); err != nil {
 		utils.InternalServerError(w, fmt.Errorf("failed repeating request"))
 		return
 	}
-	pr, err := http.NewRequest(r.Method, mehms+"/mehms/"+id+"/update?userId="+user.Id+"&isAdmin="+admin, body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	pr.Header.Add("Content-Type", "application/json")
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/mehms/" + url.PathEscape(id) + "/update",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {admin}},
+		Body:   body,
+	})
+	forward(w, res, err)
 }
 
 // Delete godoc
@@ -571,42 +585,35 @@ func (c *controller) EditMehm(w http.ResponseWriter, r *http.Request) {
 // @Failure      401  {object}  errors.ProceduralError
 // @Failure      403  {object}  errors.ProceduralError
 // @Failure      405  {object}  errors.ProceduralError
-// @Failure      422  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
 // @Failure      500  {object}  errors.ProceduralError
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /user/delete [post]
 func (c *controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var deleteId entity.DeleteUserInput
-	if err = json.NewDecoder(r.Body).Decode(&deleteId); err != nil {
-		utils.UnprocessableEntity(w, err)
+	if !c.decode(w, r, &deleteId) {
 		return
 	}
 
-	if !user.Admin && user.Id != deleteId.Id {
-		utils.Forbidden(w, err)
+	if c.policy.Scope(user, policy.DeleteUsers) != policy.Any && user.Id != deleteId.Id {
+		utils.Forbidden(w, fmt.Errorf("you may only delete yourself"))
 		return
 	}
 
-	pr, err := http.NewRequest(r.Method, users+"/delete?id="+deleteId.Id, r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-	}
+	res, err := c.users.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/delete",
+		Query:  url.Values{"id": {deleteId.Id}},
+	})
+	c.revokeOnSuccess(res, err, deleteId.Id)
+	forward(w, res, err)
 }
 
 // RemoveMehm godoc
@@ -624,9 +631,8 @@ func (c *controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /mehms/{id}/remove [post]
 func (c *controller) DeleteMehm(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -638,31 +644,13 @@ func (c *controller) DeleteMehm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	adminString := "false"
-
-	if user.Admin {
-		adminString = "true"
-	}
-
-	pr, err := http.NewRequest("POST", mehms+"/mehms/"+id+"/remove?userId="+user.Id+"&isAdmin="+adminString, r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	pr.Header.Set("Content-Type", "application/json")
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
-
-	if _, err = io.Copy(w, res.Body); err != nil {
-		utils.InternalServerError(w, err)
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/mehms/" + url.PathEscape(id) + "/remove",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {c.privileged(user, policy.DeleteMehms)}},
+		Body:   r.Body,
+	})
+	forward(w, res, err)
 }
 
 // RemoveComment godoc
@@ -680,9 +668,8 @@ func (c *controller) DeleteMehm(w http.ResponseWriter, r *http.Request) {
 // @Failure      502  {object}  errors.ProceduralError
 // @Router       /comments/remove [post]
 func (c *controller) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	user, err := apiGatewayService.Authenticate(r.Header.Get("Authorization"))
-	if err != nil {
-		utils.Unauthorized(w, err)
+	user, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
@@ -691,25 +678,32 @@ func (c *controller) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	admin := strconv.FormatBool(user.Admin)
+	admin := c.privileged(user, policy.DeleteComments)
 
-	pr, err := http.NewRequest(r.Method, mehms+"/comments/remove?commentId="+r.URL.Query().Get("commentId")+"&userId="+user.Id+"&isAdmin="+admin, r.Body)
-	if err != nil {
-		utils.InternalServerError(w, err)
-		return
-	}
-	pr.Header.Add("Content-Type", "application/json")
-	res, err := (&http.Client{}).Do(pr)
-	if err != nil {
-		utils.BadGateway(w, err)
-		return
-	}
-	if res.StatusCode != http.StatusOK {
-		utils.WrongStatus(w, res)
-		return
-	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: r.Method,
+		Path:   "/comments/remove",
+		Query:  url.Values{"commentId": {r.URL.Query().Get("commentId")}, "userId": {user.Id}, "isAdmin": {admin}},
+		Body:   r.Body,
+	})
+	forward(w, res, err)
+}
 
-	if _, err = io.Copy(w, res.Body); err != nil {
+// UpstreamStatus godoc
+// @Summary      Show the state of the upstream circuit breakers
+// @Security bearerToken
+// @Description  This is only usable for privileged users. An open circuit answers calls with 503 until its cooldown has passed.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  []upstream.BreakerStatus{}
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      403  {object}  errors.ProceduralError
+// @Failure      500  {object}  errors.ProceduralError
+// @Router       /admin/upstreams [get]
+func (c *controller) UpstreamStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode([]upstream.BreakerStatus{c.users.Status(), c.mehms.Status()}); err != nil {
 		utils.InternalServerError(w, err)
 	}
 }
@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/media"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/service"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+)
+
+// fakeBreaker answers upstream calls with handler and records them.
+type fakeBreaker struct {
+	handler  http.HandlerFunc
+	mu       sync.Mutex
+	requests []*upstream.Request
+}
+
+func (b *fakeBreaker) Name() string {
+	return "fake"
+}
+
+func (b *fakeBreaker) BaseURL() string {
+	return "http://fake"
+}
+
+func (b *fakeBreaker) Do(ctx context.Context, req *upstream.Request) (*http.Response, error) {
+	b.mu.Lock()
+	b.requests = append(b.requests, req)
+	b.mu.Unlock()
+
+	r := httptest.NewRequest(req.Method, b.BaseURL()+req.Path, req.Body).WithContext(ctx)
+	for name, values := range req.Header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	b.handler(w, r)
+	return w.Result(), nil
+}
+
+func (b *fakeBreaker) Status() upstream.BreakerStatus {
+	return upstream.BreakerStatus{Upstream: b.Name(), State: "closed"}
+}
+
+// fakeService accepts the tokens it knows and records revocations.
+type fakeService struct {
+	auth         config.Auth
+	claims       map[string]*service.Claims
+	revoked      map[string]bool
+	revokedUsers []string
+}
+
+func (s *fakeService) Authenticate(authorizationHeader string) (*entity.User, error) {
+	claims, err := s.Verify(strings.TrimPrefix(authorizationHeader, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	return claims.User(), nil
+}
+
+func (s *fakeService) AuthenticateRequest(r *http.Request) (*entity.User, error) {
+	token, err := s.TokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Authenticate("Bearer " + token)
+}
+
+// TokenFromRequest prefers the Authorization header over the auth cookie
+// like the real service: the header is only read in bearer and mixed mode,
+// the cookie only in cookie and mixed mode if no header is sent.
+func (s *fakeService) TokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); s.auth.Bearer() && (header != "" || !s.auth.Cookies()) {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == "" || token == header {
+			return "", service.ErrMissingCredentials
+		}
+		return token, nil
+	}
+	cookie, err := r.Cookie(s.auth.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", service.ErrMissingCredentials
+	}
+	return cookie.Value, nil
+}
+
+func (s *fakeService) Verify(token string) (*service.Claims, error) {
+	claims, ok := s.claims[token]
+	if !ok {
+		return nil, service.ErrInvalidSignature
+	}
+	if s.revoked[token] {
+		return nil, service.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (s *fakeService) RevokeToken(claims *service.Claims) error {
+	for token, candidate := range s.claims {
+		if candidate == claims {
+			s.revoked[token] = true
+		}
+	}
+	return nil
+}
+
+func (s *fakeService) RevokeUser(userId string) error {
+	s.revokedUsers = append(s.revokedUsers, userId)
+	return nil
+}
+
+func (s *fakeService) AuthenticateAPIKey(r *http.Request) (*entity.User, *apikey.Key, error) {
+	return nil, nil, nil
+}
+
+// respond answers with a JSON body.
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}
+}
+
+// newMehmsController builds a controller around fake users and mehms
+// services, with the genres of cfg and an empty image store. The token
+// "alice" authenticates user 1.
+func newMehmsController(t *testing.T, cfg *config.Config, users, mehms *fakeBreaker) ApiGatewayController {
+	t.Helper()
+	accessPolicy, err := policy.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genres, err := dto.NewGenreRegistry(cfg.Genres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := media.NewDirStore(t.TempDir(), "/api/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeService{auth: cfg.Auth, claims: map[string]*service.Claims{"alice": {Id: "1", Username: "alice"}}}
+	return NewApiGatewayController(cfg, fake, accessPolicy, genres, users, mehms, nil, images)
+}
+
+func TestGetAllMehms(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		upstream   string
+		wantStatus int
+		wantQuery  url.Values
+		wantBody   string
+	}{
+		{
+			name:       "genres are forwarded and named",
+			query:      "?genre=DHBW&take=2",
+			upstream:   `[{"id":1,"imageSource":"a.png","genre":1},{"id":2,"imageSource":"b.png","genre":2}]`,
+			wantStatus: http.StatusOK,
+			wantQuery:  url.Values{"skip": {"0"}, "take": {"2"}, "genre": {"DHBW"}},
+			wantBody:   `[{"genre":"DHBW","id":1,"imageSource":"a.png"},{"genre":"OTHER","id":2,"imageSource":"b.png"}]`,
+		},
+		{
+			name:       "unknown genre numbers are kept",
+			upstream:   `[{"id":1,"imageSource":"a.png","genre":7}]`,
+			wantStatus: http.StatusOK,
+			wantQuery:  url.Values{"skip": {"0"}, "take": {"30"}},
+			wantBody:   `[{"genre":7,"id":1,"imageSource":"a.png"}]`,
+		},
+		{
+			name:       "empty genre is left out",
+			query:      "?genre=&skip=",
+			upstream:   `[]`,
+			wantStatus: http.StatusOK,
+			wantQuery:  url.Values{"skip": {"0"}, "take": {"30"}},
+			wantBody:   `[]`,
+		},
+		{name: "unknown genre", query: "?genre=MEMES", wantStatus: http.StatusBadRequest},
+		{name: "genre by number", query: "?genre=1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mehms := &fakeBreaker{handler: respond(test.upstream)}
+			c := newMehmsController(t, config.Default(), &fakeBreaker{}, mehms)
+
+			w := httptest.NewRecorder()
+			c.GetAllMehms(w, httptest.NewRequest(http.MethodGet, "/api/mehms"+test.query, nil))
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.wantStatus, w.Body)
+			}
+			if test.wantStatus != http.StatusOK {
+				if len(mehms.requests) != 0 {
+					t.Errorf("invalid query was forwarded")
+				}
+				return
+			}
+			if query := mehms.requests[0].Query; !reflect.DeepEqual(query, test.wantQuery) {
+				t.Errorf("forwarded query = %v, want %v", query, test.wantQuery)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+		})
+	}
+}
+
+func TestGenres(t *testing.T) {
+	cfg := config.Default()
+	cfg.Genres = append(cfg.Genres, "MEMES")
+	c := newMehmsController(t, cfg, &fakeBreaker{}, &fakeBreaker{})
+
+	w := httptest.NewRecorder()
+	c.Genres(w, httptest.NewRequest(http.MethodGet, "/api/genres", nil))
+
+	want := `[{"id":0,"name":"PROGRAMMING"},{"id":1,"name":"DHBW"},{"id":2,"name":"OTHER"},{"id":3,"name":"MEMES"}]`
+	if body := strings.TrimSpace(w.Body.String()); body != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/jwt-server/entity"
+	procedural "github.com/nillga/jwt-server/errors"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// The parts of a dto.MehmDetail, as named in its errors.
+const (
+	partMehm     = "mehm"
+	partComments = "comments"
+	partAuthors  = "authors"
+)
+
+// mehmAuthorFields lists the names the mehms service may use for the author of a mehm.
+var mehmAuthorFields = struct {
+	id, name []string
+}{
+	id:   []string{"authorId", "userId"},
+	name: []string{"authorName", "author"},
+}
+
+// GetMehmDetail godoc
+// @Summary      View a mehm with its comments and authors
+// @Security bearerToken
+// @Security apiKey
+// @Description  Combines GetSpecificMehm, the first page of its comments and the public profiles of the authors of both. The mehms and users services are asked at the same time. If the comments or the authors cannot be read, the other parts are still returned and errors tells which part is missing. Only if the mehm itself cannot be read, the request fails with the status of that part.
+// @Tags         mehms
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int     true   "The ID of the requested mehm" minimum(1)
+// @Param        shape  query     string  false  "the shape of the comments" Enums(v2, legacy)
+// @Success      200  {object}  dto.MehmDetail{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      404  {object}  dto.MehmDetail{}
+// @Failure      502  {object}  dto.MehmDetail{}
+// @Router       /mehms/{id}/full [get]
+func (c *controller) GetMehmDetail(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		utils.BadRequest(w, fmt.Errorf("mehm specification went wrong"))
+		return
+	}
+	legacy, err := c.legacyComments(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var (
+		wg          sync.WaitGroup
+		mehm        map[string]interface{}
+		comments    []dto.CommentV2
+		total       int
+		users       []entity.User
+		mehmErr     *dto.PartError
+		commentsErr *dto.PartError
+		usersErr    *dto.PartError
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		mehm, mehmErr = c.fetchMehm(r.Context(), id, user)
+	}()
+	go func() {
+		defer wg.Done()
+		comments, total, commentsErr = c.fetchComments(r.Context(), id, dto.NewCommentQuery())
+	}()
+	go func() {
+		defer wg.Done()
+		users, usersErr = c.directoryUsers(r.Context())
+	}()
+	wg.Wait()
+
+	var detail dto.MehmDetail
+	for _, partErr := range []*dto.PartError{mehmErr, commentsErr, usersErr} {
+		if partErr != nil {
+			detail.Errors = append(detail.Errors, *partErr)
+		}
+	}
+	// without the mehm there is no page to show
+	if mehmErr != nil {
+		w.WriteHeader(mehmErr.Status)
+		encodeMehms(w, detail)
+		return
+	}
+
+	if usersErr == nil {
+		detail.Authors = resolveAuthors(users, mehm, comments)
+	}
+	detail.Mehm = mehm
+	if commentsErr == nil {
+		detail.Comments = shapeComments(comments, legacy)
+		if total >= 0 {
+			detail.TotalComments = &total
+		}
+	}
+	encodeMehms(w, detail)
+}
+
+func (c *controller) fetchMehm(ctx context.Context, id string, user *entity.User) (map[string]interface{}, *dto.PartError) {
+	res, err := c.mehms.Do(ctx, &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms/get/" + url.PathEscape(id),
+		Query:  url.Values{"userId": {user.Id}},
+	})
+	if partErr := failedPart(partMehm, res, err); partErr != nil {
+		return nil, partErr
+	}
+	defer res.Body.Close()
+
+	decoded, err := decodeMehms(res.Body)
+	if err != nil {
+		return nil, &dto.PartError{Part: partMehm, Status: http.StatusBadGateway, Message: err.Error()}
+	}
+	mehm, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, &dto.PartError{Part: partMehm, Status: http.StatusBadGateway, Message: "invalid response from mehms service: mehm is no object"}
+	}
+	c.decorateMehms(mehm)
+	return mehm, nil
+}
+
+func (c *controller) fetchComments(ctx context.Context, id string, query dto.CommentQuery) ([]dto.CommentV2, int, *dto.PartError) {
+	res, err := c.mehms.Do(ctx, &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms/" + url.PathEscape(id) + "/comments",
+		Query:  query.Values(),
+	})
+	if partErr := failedPart(partComments, res, err); partErr != nil {
+		return nil, -1, partErr
+	}
+	defer res.Body.Close()
+
+	comments, total, err := readCommentPage(res, id)
+	if err != nil {
+		return nil, -1, &dto.PartError{Part: partComments, Status: http.StatusBadGateway, Message: "invalid comments from mehms service: " + err.Error()}
+	}
+	return comments, total, nil
+}
+
+// userDirectory keeps the users of the users service for cfg.Directory.TTL.
+type userDirectory struct {
+	group     singleflight.Group
+	mu        sync.RWMutex
+	users     []entity.User
+	fetchedAt time.Time
+}
+
+type directoryResult struct {
+	users   []entity.User
+	partErr *dto.PartError
+}
+
+// directoryUsers lists all users to resolve authors from. Concurrent requests
+// share one download, which is not bound to the request that started it. If the
+// download fails, the previous list is used as long as there is one.
+func (c *controller) directoryUsers(ctx context.Context) ([]entity.User, *dto.PartError) {
+	d := &c.directory
+	d.mu.RLock()
+	users, fetchedAt := d.users, d.fetchedAt
+	d.mu.RUnlock()
+	if users != nil && time.Since(fetchedAt) < c.cfg.Directory.TTL.Duration() {
+		return users, nil
+	}
+
+	download := d.group.DoChan("users", func() (interface{}, error) {
+		users, partErr := c.fetchUsers(context.Background(), c.cfg.Directory.MaxSize)
+		if partErr == nil {
+			d.mu.Lock()
+			d.users, d.fetchedAt = users, time.Now()
+			d.mu.Unlock()
+		}
+		return directoryResult{users: users, partErr: partErr}, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, &dto.PartError{Part: partAuthors, Status: upstreamStatus(ctx.Err()), Message: ctx.Err().Error()}
+	case result := <-download:
+		fetched := result.Val.(directoryResult)
+		if fetched.partErr != nil && users != nil {
+			return users, nil
+		}
+		return fetched.users, fetched.partErr
+	}
+}
+
+// fetchUsers lists all users, reading at most limit bytes.
+func (c *controller) fetchUsers(ctx context.Context, limit int) ([]entity.User, *dto.PartError) {
+	res, err := c.users.Do(ctx, &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/all",
+	})
+	if partErr := failedPart(partAuthors, res, err); partErr != nil {
+		return nil, partErr
+	}
+	defer res.Body.Close()
+
+	var users []entity.User
+	if err = json.NewDecoder(io.LimitReader(res.Body, int64(limit))).Decode(&users); err != nil {
+		return nil, &dto.PartError{Part: partAuthors, Status: http.StatusBadGateway, Message: "invalid response from users service: " + err.Error()}
+	}
+	return users, nil
+}
+
+// failedPart describes why an upstream call for part failed, or returns nil if it succeeded.
+// The body of a failed response is released.
+func failedPart(part string, res *http.Response, err error) *dto.PartError {
+	if err != nil {
+		return &dto.PartError{Part: part, Status: upstreamStatus(err), Message: err.Error()}
+	}
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	defer res.Body.Close()
+
+	message := http.StatusText(res.StatusCode)
+	var upstreamErr procedural.ProceduralError
+	if json.NewDecoder(io.LimitReader(res.Body, maxMehmResponse)).Decode(&upstreamErr) == nil && upstreamErr.Message != "" {
+		message = upstreamErr.Message
+	}
+	return &dto.PartError{Part: part, Status: res.StatusCode, Message: message}
+}
+
+// resolveAuthors looks up the authors of the mehm and its comments by id or,
+// where only the name is known, by name, and fills in the missing half on the
+// comments. Authors that do not exist anymore are left out.
+func resolveAuthors(users []entity.User, mehm map[string]interface{}, comments []dto.CommentV2) []dto.Author {
+	byId := map[string]entity.User{}
+	byName := map[string]entity.User{}
+	for _, user := range users {
+		byId[user.Id] = user
+		byName[user.Username] = user
+	}
+
+	found := map[string]dto.Author{}
+	resolve := func(id, name string) (entity.User, bool) {
+		user, ok := byId[id]
+		if !ok && name != "" {
+			user, ok = byName[name]
+		}
+		if ok {
+			found[user.Id] = dto.Author{Id: user.Id, Name: user.Username}
+		}
+		return user, ok
+	}
+
+	if mehm != nil {
+		resolve(mehmAuthor(mehm))
+	}
+	for i := range comments {
+		comment := &comments[i]
+		if user, ok := resolve(comment.AuthorId, comment.AuthorName); ok {
+			if comment.AuthorId == "" {
+				comment.AuthorId = user.Id
+			}
+			if comment.AuthorName == "" {
+				comment.AuthorName = user.Username
+			}
+		}
+	}
+
+	authors := make([]dto.Author, 0, len(found))
+	for _, author := range found {
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		return authors[i].Name < authors[j].Name
+	})
+	return authors
+}
+
+func mehmAuthor(mehm map[string]interface{}) (id, name string) {
+	text := func(names []string) string {
+		for _, field := range names {
+			switch value := mehm[field].(type) {
+			case string:
+				return value
+			case json.Number:
+				return value.String()
+			}
+		}
+		return ""
+	}
+	return text(mehmAuthorFields.id), text(mehmAuthorFields.name)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/service"
+)
+
+func TestGetMehmDetail(t *testing.T) {
+	mehm := `{"id":5,"authorName":"carol","imageSource":"a.png","genre":1}`
+	tests := []struct {
+		name     string
+		query    string
+		comments http.HandlerFunc
+		wantBody string
+	}{
+		{
+			name:     "comments of a legacy page",
+			comments: commentPage("2", legacyComment),
+			wantBody: `{"mehm":{"authorName":"carol","genre":"DHBW","id":5,"imageSource":"a.png"},` +
+				`"comments":[{"id":0,"mehmId":5,"authorId":"1","authorName":"alice","text":"nice mehm","createdAt":"2026-01-02T03:04:05Z","editedAt":null}],` +
+				`"totalComments":2,"authors":[{"id":"1","name":"alice"},{"id":"3","name":"carol"}]}`,
+		},
+		{
+			name:     "legacy comments",
+			query:    "?shape=legacy",
+			comments: commentPage("", legacyComment),
+			wantBody: `{"mehm":{"authorName":"carol","genre":"DHBW","id":5,"imageSource":"a.png"},` +
+				`"comments":[` + legacyComment + `],"authors":[{"id":"1","name":"alice"},{"id":"3","name":"carol"}]}`,
+		},
+		{
+			name:     "invalid comments leave the rest",
+			comments: respond(`[{"id":"nice mehm"`),
+			wantBody: `{"mehm":{"authorName":"carol","genre":"DHBW","id":5,"imageSource":"a.png"},"authors":[{"id":"3","name":"carol"}],` +
+				`"errors":[{"part":"comments","status":502,"message":"invalid comments from mehms service: unexpected EOF"}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			users := &fakeBreaker{handler: respond(`[{"_id":"1","name":"alice"},{"_id":"3","name":"carol"}]`)}
+			mehms := &fakeBreaker{handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/mehms/get/5":
+					respond(mehm)(w, r)
+				case "/mehms/5/comments":
+					test.comments(w, r)
+				default:
+					http.NotFound(w, r)
+				}
+			}}
+			c := newMehmsController(t, config.Default(), users, mehms)
+
+			r := httptest.NewRequest(http.MethodGet, "/api/mehms/5/full"+test.query, nil)
+			r = mux.SetURLVars(r.WithContext(service.WithUser(r.Context(), &entity.User{Id: "1"})), map[string]string{"id": "5"})
+			w := httptest.NewRecorder()
+			c.GetMehmDetail(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxRootFields bounds the root fields, aliases included, of a GraphQL
+	// operation, since every root field calls an upstream on its own.
+	maxRootFields = 10
+	// maxQueryFields bounds the fields of a GraphQL operation with its
+	// fragments expanded, enough for an introspection query.
+	maxQueryFields = 500
+)
+
+// checkQueryCost counts the fields of the operation a GraphQL document runs,
+// or of all its operations if none is named, before it is executed.
+func checkQueryCost(query, operationName string) error {
+	document, err := parseQueryDocument(query)
+	if err != nil {
+		return err
+	}
+
+	costs := map[string]int{}
+	for _, op := range document.operations {
+		if operationName != "" && op.name != operationName {
+			continue
+		}
+		roots, err := document.count(op.selections, costs, map[string]bool{}, false)
+		if err != nil {
+			return err
+		}
+		if roots > maxRootFields {
+			return fmt.Errorf("query selects %d root fields, at most %d are allowed", roots, maxRootFields)
+		}
+		fields, err := document.count(op.selections, costs, map[string]bool{}, true)
+		if err != nil {
+			return err
+		}
+		if fields > maxQueryFields {
+			return fmt.Errorf("query selects %d fields, at most %d are allowed", fields, maxQueryFields)
+		}
+	}
+	return nil
+}
+
+// selection is a field, an inline fragment or a fragment spread.
+type selection struct {
+	field      bool
+	spread     string
+	selections []selection
+}
+
+type operation struct {
+	name       string
+	selections []selection
+}
+
+type queryDocument struct {
+	operations []operation
+	fragments  map[string][]selection
+}
+
+// count counts the fields of selections, expanding fragments. Unless deep,
+// only the fields of the selection set itself are counted.
+func (d *queryDocument) count(selections []selection, costs map[string]int, visiting map[string]bool, deep bool) (int, error) {
+	total := 0
+	for _, s := range selections {
+		switch {
+		case s.field:
+			total++
+			if deep {
+				nested, err := d.count(s.selections, costs, visiting, deep)
+				if err != nil {
+					return 0, err
+				}
+				total += nested
+			}
+		case s.spread != "":
+			if cost, ok := costs[s.spread]; ok && deep {
+				total += cost
+				continue
+			}
+			fragment, ok := d.fragments[s.spread]
+			if !ok {
+				return 0, fmt.Errorf("unknown fragment %s", s.spread)
+			}
+			if visiting[s.spread] {
+				return 0, fmt.Errorf("fragment %s spreads itself", s.spread)
+			}
+			visiting[s.spread] = true
+			cost, err := d.count(fragment, costs, visiting, deep)
+			delete(visiting, s.spread)
+			if err != nil {
+				return 0, err
+			}
+			if deep {
+				costs[s.spread] = cost
+			}
+			total += cost
+		default:
+			nested, err := d.count(s.selections, costs, visiting, deep)
+			if err != nil {
+				return 0, err
+			}
+			total += nested
+		}
+		if total > maxQueryFields {
+			// no need to expand any further
+			return total, nil
+		}
+	}
+	return total, nil
+}
+
+// queryParser reads the parts of a GraphQL document that decide its cost.
+// Arguments, variables and directives are skipped.
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseQueryDocument(query string) (*queryDocument, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	document := &queryDocument{fragments: map[string][]selection{}}
+
+	for p.pos < len(p.tokens) {
+		switch token := p.next(); token {
+		case "{":
+			p.pos--
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, operation{selections: selections})
+		case "query", "mutation", "subscription":
+			var op operation
+			if isName(p.peek()) {
+				op.name = p.next()
+			}
+			if p.peek() == "(" {
+				if err = p.skipGroup("(", ")"); err != nil {
+					return nil, err
+				}
+			}
+			if err = p.directives(); err != nil {
+				return nil, err
+			}
+			if op.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, op)
+		case "fragment":
+			name := p.next()
+			if !isName(name) || p.next() != "on" || !isName(p.next()) {
+				return nil, fmt.Errorf("invalid fragment definition")
+			}
+			if err = p.directives(); err != nil {
+				return nil, err
+			}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.fragments[name] = selections
+		default:
+			return nil, fmt.Errorf("unexpected %q in query", token)
+		}
+	}
+	return document, nil
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *queryParser) selectionSet() ([]selection, error) {
+	if p.next() != "{" {
+		return nil, fmt.Errorf("expected selection set in query")
+	}
+	var selections []selection
+	for p.peek() != "}" {
+		if p.pos >= len(p.tokens) {
+			return nil, fmt.Errorf("unterminated selection set in query")
+		}
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	p.pos++
+	return selections, nil
+}
+
+func (p *queryParser) selection() (selection, error) {
+	var s selection
+	var err error
+	token := p.next()
+	switch {
+	case token == "...":
+		if name := p.peek(); isName(name) && name != "on" {
+			p.pos++
+			s.spread = name
+			return s, p.directives()
+		}
+		if p.peek() == "on" {
+			p.pos += 2
+		}
+		if err = p.directives(); err != nil {
+			return s, err
+		}
+		s.selections, err = p.selectionSet()
+		return s, err
+	case isName(token):
+		s.field = true
+		if p.peek() == ":" {
+			p.pos++
+			if !isName(p.next()) {
+				return s, fmt.Errorf("invalid alias %s in query", token)
+			}
+		}
+		if p.peek() == "(" {
+			if err = p.skipGroup("(", ")"); err != nil {
+				return s, err
+			}
+		}
+		if err = p.directives(); err != nil {
+			return s, err
+		}
+		if p.peek() == "{" {
+			s.selections, err = p.selectionSet()
+		}
+		return s, err
+	}
+	return s, fmt.Errorf("unexpected %q in query", token)
+}
+
+func (p *queryParser) directives() error {
+	for p.peek() == "@" {
+		p.pos++
+		if !isName(p.next()) {
+			return fmt.Errorf("invalid directive in query")
+		}
+		if p.peek() == "(" {
+			if err := p.skipGroup("(", ")"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipGroup skips a balanced group of tokens like arguments.
+func (p *queryParser) skipGroup(open, close string) error {
+	depth := 0
+	for p.pos < len(p.tokens) {
+		switch p.next() {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unterminated %s in query", open)
+}
+
+func isName(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i, r := range token {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// lexQuery splits a GraphQL document into punctuators, names and values.
+// Strings are kept quoted so they never look like names or punctuators.
+func lexQuery(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "\xef\xbb\xbf"):
+			i += 3
+		case strings.HasPrefix(query[i:], `"""`):
+			end := i + 3
+			for ; end < len(query) && !strings.HasPrefix(query[end:], `"""`); end++ {
+				if strings.HasPrefix(query[end:], `\"""`) {
+					end += 3
+				}
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string in query")
+			}
+			tokens = append(tokens, query[i:end+3])
+			i = end + 3
+		case c == '"':
+			end := i + 1
+			for ; end < len(query) && query[end] != '"'; end++ {
+				if query[end] == '\\' {
+					end++
+				} else if query[end] == '\n' || query[end] == '\r' {
+					break
+				}
+			}
+			if end >= len(query) || query[end] != '"' {
+				return nil, fmt.Errorf("unterminated string in query")
+			}
+			tokens = append(tokens, query[i:end+1])
+			i = end + 1
+		case strings.HasPrefix(query[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+			tokens = append(tokens, query[i:i+1])
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			end := i + 1
+			for end < len(query) && (query[end] == '_' || query[end] >= 'a' && query[end] <= 'z' || query[end] >= 'A' && query[end] <= 'Z' || query[end] >= '0' && query[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, query[i:end])
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(query) && strings.IndexByte("0123456789.eE+-", query[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, query[i:end])
+			i = end
+		default:
+			r, _ := utf8.DecodeRuneInString(query[i:])
+			return nil, fmt.Errorf("unexpected character %q in query", r)
+		}
+	}
+	return tokens, nil
+}
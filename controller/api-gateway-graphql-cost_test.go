@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fields lists n fields named prefix1 to prefixn.
+func fields(prefix string, n int) string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d", prefix, i+1)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestLexQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		wantErr string
+	}{
+		{name: "spread without spaces", query: "{a...F}", want: []string{"{", "a", "...", "F", "}"}},
+		{name: "commas and byte order mark", query: "\xef\xbb\xbf{a,b,,c}", want: []string{"{", "a", "b", "c", "}"}},
+		{
+			name:  "arguments and variables",
+			query: `query Q($n: Int! = -1.5e3) { a(n: $n, l: [1]) @skip(if: false) }`,
+			want:  []string{"query", "Q", "(", "$", "n", ":", "Int", "!", "=", "-1.5e3", ")", "{", "a", "(", "n", ":", "$", "n", "l", ":", "[", "1", "]", ")", "@", "skip", "(", "if", ":", "false", ")", "}"},
+		},
+		{name: "strings hide names and punctuators", query: `{a(s: "} b { \" ...")}`, want: []string{"{", "a", "(", "s", ":", `"} b { \" ..."`, ")", "}"}},
+		{name: "block strings", query: "{a(s: \"\"\"x \"\" \\\"\"\" {\ny\"\"\")}", want: []string{"{", "a", "(", "s", ":", "\"\"\"x \"\" \\\"\"\" {\ny\"\"\"", ")", "}"}},
+		{name: "comments", query: "{a # b { c\r\nd}", want: []string{"{", "a", "d", "}"}},
+		{name: "unterminated string", query: `{a(s: "b)}`, wantErr: "unterminated string in query"},
+		{name: "string over lines", query: "{a(s: \"b\n\")}", wantErr: "unterminated string in query"},
+		{name: "unterminated block string", query: `{a(s: """b")}`, wantErr: "unterminated string in query"},
+		{name: "unexpected character", query: "{a ä}", wantErr: `unexpected character 'ä' in query`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokens, err := lexQuery(test.query)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("lexQuery() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tokens, test.want) {
+				t.Errorf("lexQuery() = %q, want %q", tokens, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckQueryCost(t *testing.T) {
+	// every n selects F, 17 times 31 fields exceed maxQueryFields
+	wide := "{ m { " + strings.Repeat("n { ...F } ", 16) + "} } fragment F on Mehm { " + fields("f", 30) + " }"
+	tooWide := "{ m { " + strings.Repeat("n { ...F } ", 17) + "} } fragment F on Mehm { " + fields("f", 30) + " }"
+
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		wantErr       string
+	}{
+		{name: "root fields at the limit", query: "{ " + fields("a", 10) + " }"},
+		{name: "too many root fields", query: "{ " + fields("a", 11) + " }", wantErr: "query selects 11 root fields, at most 10 are allowed"},
+		{name: "aliases are root fields", query: "{ " + strings.Repeat("m: mehms ", 11) + "}", wantErr: "query selects 11 root fields"},
+		{name: "root fields in fragments", query: "{ a ...F } fragment F on Query { " + fields("b", 10) + " }", wantErr: "query selects 11 root fields"},
+		{name: "root fields in inline fragments", query: "{ a ... on Query { " + fields("b", 10) + " } }", wantErr: "query selects 11 root fields"},
+		{name: "nested fields are no root fields", query: "{ m { " + fields("a", 20) + " } }"},
+		{name: "fields at the limit", query: wide},
+		{name: "too many fields", query: tooWide, wantErr: "query selects 528 fields, at most 500 are allowed"},
+		{name: "arguments and directives", query: `query Q($id: ID!) @a { m(id: $id, s: "}") @include(if: true) { id } }`},
+		{name: "named operation", query: "query Small { a } query Big { " + fields("a", 11) + " }", operationName: "Small"},
+		{name: "other named operation", query: "query Small { a } query Big { " + fields("a", 11) + " }", operationName: "Big", wantErr: "query selects 11 root fields"},
+		{name: "all operations without name", query: "query Small { a } query Big { " + fields("a", 11) + " }", wantErr: "query selects 11 root fields"},
+		{name: "fragment cycle", query: "{ ...A } fragment A on Query { ...B } fragment B on Query { ...A }", wantErr: "fragment A spreads itself"},
+		{name: "unknown fragment", query: "{ ...G }", wantErr: "unknown fragment G"},
+		{name: "unterminated selection set", query: "{ a { b }", wantErr: "unterminated selection set in query"},
+		{name: "unterminated arguments", query: "{ a(b: 1 }", wantErr: "unterminated ( in query"},
+		{name: "invalid fragment", query: "{ ...F } fragment F { a }", wantErr: "invalid fragment definition"},
+		{name: "invalid alias", query: "{ a: 1 }", wantErr: "invalid alias a in query"},
+		{name: "no operation", query: "mehms", wantErr: `unexpected "mehms" in query`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkQueryCost(test.query, test.operationName)
+			if test.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), test.wantErr)) {
+				t.Errorf("checkQueryCost() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,708 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/graph-gophers/dataloader"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/service"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+	"github.com/nillga/mehm-services-api-gateway/validation"
+)
+
+//go:embed api-gateway-schema.graphql
+var schema string
+
+// maxQueryDepth bounds the nesting of GraphQL queries, enough for mehms { comments { items { author } } }.
+const maxQueryDepth = 8
+
+type GraphQLController interface {
+	GraphQL(w http.ResponseWriter, r *http.Request)
+}
+
+// GraphQL godoc
+// @Summary      Query mehms, comments and users with GraphQL
+// @Security bearerToken
+// @Security apiKey
+// @Description  The schema is served by introspection, which like the genres needs no credentials. Invalid credentials are refused with 401 though. An operation selects at most 10 root fields and 500 fields in total, fragments expanded, otherwise it is rejected with 422 before it runs. Every field and mutation needs the same permission as its REST route and calls the same upstream. Errors carry the status the REST route would have answered with in their extensions.
+// @Tags         graphql
+// @Accept       json
+// @Produce      json
+// @Param        input   body      dto.GraphQLRequest  true  "The query"
+// @Success      200  {object}  interface{}
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      422  {object}  validation.Error
+// @Router       /graphql [post]
+func (c *controller) GraphQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var input dto.GraphQLRequest
+	if !c.decode(w, r, &input) {
+		return
+	}
+	if err := checkQueryCost(input.Query, input.OperationName); err != nil {
+		utils.UnprocessableEntity(w, err)
+		return
+	}
+
+	// the route is public, so the schema and the genres can be read without
+	// credentials; every other field asks for its permission through authorized
+	ctx := r.Context()
+	user, key, err := c.service.AuthenticateAPIKey(r)
+	if err == nil && key == nil {
+		user, err = c.service.AuthenticateRequest(r)
+	}
+	switch {
+	case errors.Is(err, service.ErrMissingCredentials):
+	case err != nil:
+		utils.Unauthorized(w, err)
+		return
+	default:
+		ctx = service.WithUser(ctx, user)
+		if key != nil {
+			ctx = service.WithAPIKey(ctx, key)
+		}
+	}
+
+	ctx = context.WithValue(ctx, authorLoaderKey{}, dataloader.NewBatchedLoader(c.loadAuthors))
+	response := c.schema.Exec(ctx, input.Query, input.OperationName, input.Variables)
+	encodeMehms(w, response)
+}
+
+// graphError is the GraphQL counterpart of an error response of the REST routes.
+type graphError struct {
+	status  int
+	message string
+	fields  []validation.FieldError
+}
+
+func (e *graphError) Error() string {
+	return e.message
+}
+
+func (e *graphError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"status": e.status}
+	if len(e.fields) > 0 {
+		extensions["fields"] = e.fields
+	}
+	return extensions
+}
+
+func partError(partErr *dto.PartError) error {
+	if partErr == nil {
+		return nil
+	}
+	return &graphError{status: partErr.Status, message: partErr.Message}
+}
+
+func invalidInput(err error) error {
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		return &graphError{status: http.StatusUnprocessableEntity, message: invalid.Message, fields: invalid.Fields}
+	}
+	return err
+}
+
+// authorized applies the permission of the matching REST route to the caller.
+func (c *controller) authorized(ctx context.Context, permission policy.Permission) (*entity.User, error) {
+	user, ok := service.UserFromContext(ctx)
+	if !ok {
+		return nil, &graphError{status: http.StatusUnauthorized, message: "unauthenticated"}
+	}
+	if service.Scope(ctx, c.policy, permission) == policy.None {
+		return nil, &graphError{status: http.StatusForbidden, message: fmt.Sprintf("missing permission %s", permission)}
+	}
+	return user, nil
+}
+
+// mutate sends a change of part to the mehms service. The result is true or, if the change failed, null.
+func (c *controller) mutate(ctx context.Context, part string, req *upstream.Request) (*bool, error) {
+	res, err := c.mehms.Do(ctx, req)
+	if err = partError(failedPart(part, res, err)); err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	done := true
+	return &done, nil
+}
+
+func jsonBody(v interface{}) (*bytes.Buffer, error) {
+	body := &bytes.Buffer{}
+	if err := json.NewEncoder(body).Encode(v); err != nil {
+		return nil, fmt.Errorf("failed repeating request")
+	}
+	return body, nil
+}
+
+// graphResolver resolves the root types of the schema.
+type graphResolver struct {
+	c *controller
+}
+
+type feedArgs struct {
+	Skip       int32
+	Take       int32
+	TextSearch *string
+	Genre      *string
+	Sort       *string
+}
+
+func (g *graphResolver) Mehms(ctx context.Context, args feedArgs) (*[]*mehmResolver, error) {
+	if _, err := g.c.authorized(ctx, policy.ReadMehms); err != nil {
+		return nil, err
+	}
+	query := dto.NewFeedQuery()
+	query.Skip, query.Take = int(args.Skip), int(args.Take)
+	if args.TextSearch != nil {
+		query.TextSearch = *args.TextSearch
+	}
+	if args.Sort != nil {
+		query.Sort = *args.Sort
+	}
+	if args.Genre != nil && *args.Genre != "" {
+		genre, err := g.c.genres.Parse(*args.Genre)
+		if err != nil {
+			return nil, &graphError{status: http.StatusBadRequest, message: err.Error()}
+		}
+		query.Genre = &genre
+	}
+	if err := validation.Validate(&query); err != nil {
+		return nil, invalidInput(err)
+	}
+
+	res, err := g.c.mehms.Do(ctx, &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/mehms",
+		Query:  query.Values(),
+	})
+	if err = partError(failedPart(partMehm, res, err)); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	feed, err := decodeMehms(res.Body)
+	if err != nil {
+		return nil, &graphError{status: http.StatusBadGateway, message: err.Error()}
+	}
+	g.c.decorateMehms(feed)
+	var mehms []*mehmResolver
+	for _, payload := range collectMehms(feed) {
+		mehm, err := g.c.newMehmResolver(payload)
+		if err != nil {
+			return nil, err
+		}
+		mehms = append(mehms, mehm)
+	}
+	return &mehms, nil
+}
+
+func (g *graphResolver) Mehm(ctx context.Context, args struct{ Id graphql.ID }) (*mehmResolver, error) {
+	user, err := g.c.authorized(ctx, policy.ReadMehms)
+	if err != nil {
+		return nil, err
+	}
+	payload, partErr := g.c.fetchMehm(ctx, string(args.Id), user)
+	if partErr != nil {
+		return nil, partError(partErr)
+	}
+	return g.c.newMehmResolver(payload)
+}
+
+func (g *graphResolver) Comment(ctx context.Context, args struct{ Id graphql.ID }) (*commentResolver, error) {
+	if _, err := g.c.authorized(ctx, policy.ReadComments); err != nil {
+		return nil, err
+	}
+	res, err := g.c.mehms.Do(ctx, &upstream.Request{
+		Method: http.MethodGet,
+		Path:   "/comments/get/" + url.PathEscape(string(args.Id)),
+	})
+	if err = partError(failedPart(partComments, res, err)); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	comment, err := readComment(res.Body, string(args.Id))
+	if err != nil {
+		return nil, &graphError{status: http.StatusBadGateway, message: "invalid comment from mehms service: " + err.Error()}
+	}
+	return &commentResolver{c: g.c, comment: comment}, nil
+}
+
+func (g *graphResolver) Genres() []*genreResolver {
+	genres := g.c.genres.Genres()
+	resolvers := make([]*genreResolver, len(genres))
+	for i, genre := range genres {
+		resolvers[i] = &genreResolver{genre}
+	}
+	return resolvers
+}
+
+func (g *graphResolver) Me(ctx context.Context) (*userResolver, error) {
+	user, err := g.c.authorized(ctx, policy.ReadProfile)
+	if err != nil {
+		return nil, err
+	}
+	return &userResolver{c: g.c, user: *user}, nil
+}
+
+func (g *graphResolver) Users(ctx context.Context) (*[]*userResolver, error) {
+	if _, err := g.c.authorized(ctx, policy.ListUsers); err != nil {
+		return nil, err
+	}
+	users, partErr := g.c.fetchUsers(ctx, g.c.cfg.Directory.MaxSize)
+	if partErr != nil {
+		return nil, partError(partErr)
+	}
+	resolvers := make([]*userResolver, len(users))
+	for i, user := range users {
+		resolvers[i] = &userResolver{c: g.c, user: user}
+	}
+	return &resolvers, nil
+}
+
+func (g *graphResolver) LikeMehm(ctx context.Context, args struct{ Id graphql.ID }) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.LikeMehms)
+	if err != nil {
+		return nil, err
+	}
+	return g.c.mutate(ctx, partMehm, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/mehms/" + url.PathEscape(string(args.Id)) + "/like",
+		Query:  url.Values{"userId": {user.Id}},
+	})
+}
+
+func (g *graphResolver) EditMehm(ctx context.Context, args struct {
+	Id          graphql.ID
+	Title       string
+	Description string
+}) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.EditMehms)
+	if err != nil {
+		return nil, err
+	}
+	input := dto.MehmInput{Title: args.Title, Description: args.Description}
+	if err = validation.Validate(&input); err != nil {
+		return nil, invalidInput(err)
+	}
+	body, err := jsonBody(input)
+	if err != nil {
+		return nil, err
+	}
+	return g.c.mutate(ctx, partMehm, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/mehms/" + url.PathEscape(string(args.Id)) + "/update",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {g.c.privileged(user, policy.EditMehms)}},
+		Body:   body,
+	})
+}
+
+func (g *graphResolver) DeleteMehm(ctx context.Context, args struct{ Id graphql.ID }) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.DeleteMehms)
+	if err != nil {
+		return nil, err
+	}
+	return g.c.mutate(ctx, partMehm, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/mehms/" + url.PathEscape(string(args.Id)) + "/remove",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {g.c.privileged(user, policy.DeleteMehms)}},
+	})
+}
+
+func (g *graphResolver) PostComment(ctx context.Context, args struct {
+	MehmId graphql.ID
+	Text   string
+}) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.PostComments)
+	if err != nil {
+		return nil, err
+	}
+	mehmId, err := strconv.ParseInt(string(args.MehmId), 10, 64)
+	if err != nil {
+		return nil, &graphError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid mehm ID %s", args.MehmId)}
+	}
+	comment := dto.Comment{MehmId: mehmId, Comment: args.Text}
+	if err = validation.Validate(&comment); err != nil {
+		return nil, invalidInput(err)
+	}
+	body, err := jsonBody(comment)
+	if err != nil {
+		return nil, err
+	}
+	return g.c.mutate(ctx, partComments, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/comments/new",
+		Query:  url.Values{"userId": {user.Id}},
+		Body:   body,
+	})
+}
+
+func (g *graphResolver) EditComment(ctx context.Context, args struct {
+	Id   graphql.ID
+	Text string
+}) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.EditComments)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(string(args.Id), 10, 64)
+	if err != nil {
+		return nil, &graphError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid comment ID %s", args.Id)}
+	}
+	input := dto.CommentInput{Id: id, Comment: args.Text}
+	if err = validation.Validate(&input); err != nil {
+		return nil, invalidInput(err)
+	}
+	body, err := jsonBody(input)
+	if err != nil {
+		return nil, err
+	}
+	return g.c.mutate(ctx, partComments, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/comments/update",
+		Query:  url.Values{"userId": {user.Id}, "isAdmin": {g.c.privileged(user, policy.EditComments)}},
+		Body:   body,
+	})
+}
+
+func (g *graphResolver) DeleteComment(ctx context.Context, args struct{ Id graphql.ID }) (*bool, error) {
+	user, err := g.c.authorized(ctx, policy.DeleteComments)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := strconv.Atoi(string(args.Id)); err != nil || id < 1 {
+		return nil, &graphError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid comment ID %s", args.Id)}
+	}
+	return g.c.mutate(ctx, partComments, &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/comments/remove",
+		Query:  url.Values{"commentId": {string(args.Id)}, "userId": {user.Id}, "isAdmin": {g.c.privileged(user, policy.DeleteComments)}},
+	})
+}
+
+// collectMehms finds the mehms in a decorated payload in the order the mehms service sent them.
+func collectMehms(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		var mehms []map[string]interface{}
+		for _, item := range v {
+			mehms = append(mehms, collectMehms(item)...)
+		}
+		return mehms
+	case map[string]interface{}:
+		if _, isMehm := v["imageSource"]; isMehm && mehmId(v) != "" {
+			return []map[string]interface{}{v}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var mehms []map[string]interface{}
+		for _, key := range keys {
+			mehms = append(mehms, collectMehms(v[key])...)
+		}
+		return mehms
+	}
+	return nil
+}
+
+type mehmResolver struct {
+	c        *controller
+	mehm     dto.MehmDTO
+	genre    string
+	authorId string
+}
+
+// newMehmResolver reads a mehm decorated by decorateMehms. The genre is kept
+// as it is, so a genre the gateway does not know yet does not fail the mehm.
+func (c *controller) newMehmResolver(payload map[string]interface{}) (*mehmResolver, error) {
+	fields := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		if key != "genre" {
+			fields[key] = value
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	resolver := &mehmResolver{c: c}
+	switch genre := payload["genre"].(type) {
+	case string:
+		resolver.genre = genre
+	case json.Number:
+		resolver.genre = genre.String()
+	}
+	if err = json.Unmarshal(raw, &resolver.mehm); err != nil {
+		return nil, &graphError{status: http.StatusBadGateway, message: "invalid mehm from mehms service: " + err.Error()}
+	}
+	resolver.authorId, _ = mehmAuthor(payload)
+	return resolver, nil
+}
+
+func (m *mehmResolver) Id() graphql.ID {
+	return graphql.ID(strconv.Itoa(m.mehm.Id))
+}
+
+func (m *mehmResolver) AuthorName() string {
+	return m.mehm.AuthorName
+}
+
+func (m *mehmResolver) Author(ctx context.Context) (*userResolver, error) {
+	return m.c.author(ctx, m.authorId, m.mehm.AuthorName)
+}
+
+func (m *mehmResolver) Title() string {
+	return m.mehm.Title
+}
+
+func (m *mehmResolver) Description() string {
+	return m.mehm.Description
+}
+
+func (m *mehmResolver) ImageSource() string {
+	return m.mehm.ImageSource
+}
+
+func (m *mehmResolver) CreatedDate() string {
+	return m.mehm.CreatedDate.Format(time.RFC3339)
+}
+
+func (m *mehmResolver) Genre() string {
+	return m.genre
+}
+
+func (m *mehmResolver) Likes() int32 {
+	return int32(m.mehm.Likes)
+}
+
+func (m *mehmResolver) Variants() []*variantResolver {
+	names := make([]string, 0, len(m.mehm.Variants))
+	for name := range m.mehm.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variants := make([]*variantResolver, len(names))
+	for i, name := range names {
+		variants[i] = &variantResolver{name: name, url: m.mehm.Variants[name]}
+	}
+	return variants
+}
+
+func (m *mehmResolver) Comments(ctx context.Context, args struct {
+	Skip int32
+	Take int32
+	Sort string
+}) (*commentPageResolver, error) {
+	if _, err := m.c.authorized(ctx, policy.ReadMehms); err != nil {
+		return nil, err
+	}
+	query := dto.CommentQuery{Skip: int(args.Skip), Take: int(args.Take), Sort: args.Sort}
+	if err := validation.Validate(&query); err != nil {
+		return nil, invalidInput(err)
+	}
+	comments, total, partErr := m.c.fetchComments(ctx, strconv.Itoa(m.mehm.Id), query)
+	if partErr != nil {
+		return nil, partError(partErr)
+	}
+
+	page := &commentPageResolver{items: make([]*commentResolver, len(comments))}
+	for i, comment := range comments {
+		page.items[i] = &commentResolver{c: m.c, comment: comment}
+	}
+	if total >= 0 {
+		count := int32(total)
+		page.totalCount = &count
+	}
+	return page, nil
+}
+
+type variantResolver struct {
+	name, url string
+}
+
+func (v *variantResolver) Name() string {
+	return v.name
+}
+
+func (v *variantResolver) Url() string {
+	return v.url
+}
+
+type commentPageResolver struct {
+	totalCount *int32
+	items      []*commentResolver
+}
+
+func (p *commentPageResolver) TotalCount() *int32 {
+	return p.totalCount
+}
+
+func (p *commentPageResolver) Items() []*commentResolver {
+	return p.items
+}
+
+type commentResolver struct {
+	c       *controller
+	comment dto.CommentV2
+}
+
+func (r *commentResolver) Id() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.comment.Id, 10))
+}
+
+func (r *commentResolver) MehmId() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.comment.MehmId, 10))
+}
+
+func (r *commentResolver) AuthorId() string {
+	return r.comment.AuthorId
+}
+
+func (r *commentResolver) AuthorName() string {
+	return r.comment.AuthorName
+}
+
+func (r *commentResolver) Author(ctx context.Context) (*userResolver, error) {
+	return r.c.author(ctx, r.comment.AuthorId, r.comment.AuthorName)
+}
+
+func (r *commentResolver) Text() string {
+	return r.comment.Text
+}
+
+func (r *commentResolver) CreatedAt() string {
+	return r.comment.CreatedAt.Format(time.RFC3339)
+}
+
+func (r *commentResolver) EditedAt() *string {
+	if r.comment.EditedAt == nil {
+		return nil
+	}
+	edited := r.comment.EditedAt.Format(time.RFC3339)
+	return &edited
+}
+
+type userResolver struct {
+	c    *controller
+	user entity.User
+}
+
+func (u *userResolver) Id() graphql.ID {
+	return graphql.ID(u.user.Id)
+}
+
+func (u *userResolver) Name() string {
+	return u.user.Username
+}
+
+// Email is shown to the user and to those who may list all users, like GET /user/all does.
+func (u *userResolver) Email(ctx context.Context) *string {
+	if !u.private(ctx) {
+		return nil
+	}
+	return &u.user.Email
+}
+
+// Admin is shown like Email.
+func (u *userResolver) Admin(ctx context.Context) *bool {
+	if !u.private(ctx) {
+		return nil
+	}
+	return &u.user.Admin
+}
+
+// private tells whether the caller may see the private fields of the user.
+func (u *userResolver) private(ctx context.Context) bool {
+	caller, ok := service.UserFromContext(ctx)
+	return ok && (caller.Id == u.user.Id || service.Scope(ctx, u.c.policy, policy.ListUsers) == policy.Any)
+}
+
+type genreResolver struct {
+	genre dto.GenreDTO
+}
+
+func (g *genreResolver) Id() int32 {
+	return int32(g.genre.Id)
+}
+
+func (g *genreResolver) Name() string {
+	return g.genre.Name
+}
+
+type authorLoaderKey struct{}
+
+// authorKey looks an author up by id or, if the id is unknown, by name.
+type authorKey struct {
+	id, name string
+}
+
+func (k authorKey) String() string {
+	if k.id != "" {
+		return "id:" + k.id
+	}
+	return "name:" + k.name
+}
+
+func (k authorKey) Raw() interface{} {
+	return k
+}
+
+// author resolves an author through the loader of the request, so all authors
+// of a query are read with a single call to the users service.
+func (c *controller) author(ctx context.Context, id, name string) (*userResolver, error) {
+	loader, ok := ctx.Value(authorLoaderKey{}).(*dataloader.Loader)
+	if !ok || (id == "" && name == "") {
+		return nil, nil
+	}
+	found, err := loader.Load(ctx, authorKey{id: id, name: name})()
+	if err != nil || found == nil {
+		return nil, err
+	}
+	return &userResolver{c: c, user: found.(entity.User)}, nil
+}
+
+func (c *controller) loadAuthors(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	results := make([]*dataloader.Result, len(keys))
+	users, partErr := c.directoryUsers(ctx)
+	if partErr != nil {
+		for i := range results {
+			results[i] = &dataloader.Result{Error: partError(partErr)}
+		}
+		return results
+	}
+
+	byId := map[string]entity.User{}
+	byName := map[string]entity.User{}
+	for _, user := range users {
+		byId[user.Id] = user
+		byName[user.Username] = user
+	}
+	for i, key := range keys {
+		wanted := key.Raw().(authorKey)
+		user, ok := byId[wanted.id]
+		if !ok && wanted.name != "" {
+			user, ok = byName[wanted.name]
+		}
+		results[i] = &dataloader.Result{}
+		if ok {
+			results[i].Data = user
+		}
+	}
+	return results
+}
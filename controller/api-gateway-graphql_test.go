@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nillga/mehm-services-api-gateway/config"
+)
+
+func TestGraphQLComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		upstream http.HandlerFunc
+		wantBody string
+	}{
+		{
+			name:     "legacy comment",
+			token:    "alice",
+			upstream: respond(legacyComment),
+			wantBody: `{"data":{"comment":{"id":"7","mehmId":"0","authorName":"alice","text":"nice mehm","createdAt":"2026-01-02T03:04:05Z"}}}`,
+		},
+		{
+			name:     "invalid comment",
+			token:    "alice",
+			upstream: respond(`{"id":"nice`),
+			wantBody: `{"errors":[{"message":"invalid comment from mehms service: unexpected EOF","path":["comment"],"extensions":{"status":502}}],"data":{"comment":null}}`,
+		},
+		{
+			name:     "without credentials",
+			upstream: respond(legacyComment),
+			wantBody: `{"errors":[{"message":"unauthenticated","path":["comment"],"extensions":{"status":401}}],"data":{"comment":null}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mehms := &fakeBreaker{handler: test.upstream}
+			c := newMehmsController(t, config.Default(), &fakeBreaker{}, mehms)
+
+			query := `{"query":"{ comment(id: \"7\") { id mehmId authorName text createdAt } }"}`
+			r := httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(query))
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			c.GraphQL(w, r)
+
+			if body := strings.TrimSpace(w.Body.String()); body != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/media"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
+	"github.com/nillga/mehm-services-api-gateway/utils"
+)
+
+type UploadController interface {
+	CreateMehm(w http.ResponseWriter, r *http.Request)
+	Image(w http.ResponseWriter, r *http.Request)
+}
+
+// maxFormOverhead is allowed on top of the image for the text fields and multipart framing.
+const maxFormOverhead = 64 << 10
+
+// maxMehmResponse bounds the upstream answers the gateway decodes to add image variants and genre names.
+const maxMehmResponse = 8 << 20
+
+// mehmFields are the text fields of an upload with their maximum length, mirroring dto.MehmInput.
+var mehmFields = map[string]int{
+	"title":       32,
+	"description": 128,
+	"genre":       32,
+}
+
+type formError struct {
+	err error
+}
+
+func (e *formError) Error() string {
+	return e.err.Error()
+}
+
+// CreateMehm godoc
+// @Summary      Upload a new mehm
+// @Security bearerToken
+// @Description  The image has to be a PNG, JPEG, GIF or WebP file. Its format is detected from its content, not from the declared content type. The gateway strips all metadata, re-encodes the image and adds thumbnails to the mehm's variants.
+// @Tags         mehms
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        image        formData  file    true  "The image of the mehm"
+// @Param        title        formData  string  true  "The title of the mehm" minlength(1) maxlength(32)
+// @Param        description  formData  string  true  "The description of the mehm" minlength(1) maxlength(128)
+// @Param        genre        formData  string  true  "The name of the genre of the mehm, GET /genres lists them"
+// @Success      200  {object}  dto.MehmDTO{}
+// @Failure      400  {object}  errors.ProceduralError
+// @Failure      401  {object}  errors.ProceduralError
+// @Failure      413  {object}  errors.ProceduralError
+// @Failure      415  {object}  errors.ProceduralError
+// @Failure      422  {object}  errors.ProceduralError
+// @Failure      502  {object}  errors.ProceduralError
+// @Router       /mehms/new [post]
+func (c *controller) CreateMehm(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	maxImageSize := int64(c.cfg.Upload.MaxImageSize)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{media.LimitReader(r.Body, maxImageSize+maxFormOverhead), r.Body}
+	form, err := r.MultipartReader()
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	fields, image, err := readMehm(form, maxImageSize, c.genres)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	variants, err := media.Process(image, c.cfg.Upload.MediaOptions())
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+
+	body, contentType, err := mehmForm(fields, variants[0])
+	if err != nil {
+		utils.InternalServerError(w, fmt.Errorf("failed repeating request"))
+		return
+	}
+	res, err := c.mehms.Do(r.Context(), &upstream.Request{
+		Method: http.MethodPost,
+		Path:   "/mehms/new",
+		Query:  url.Values{"userId": {user.Id}},
+		Body:   body,
+		Header: http.Header{"Content-Type": {contentType}},
+	})
+	if err != nil || res.StatusCode != http.StatusOK {
+		forward(w, res, err)
+		return
+	}
+	defer res.Body.Close()
+
+	mehm, err := decodeMehms(res.Body)
+	if err != nil {
+		utils.BadGateway(w, err)
+		return
+	}
+	if created, ok := mehm.(map[string]interface{}); ok && mehmId(created) != "" {
+		if err = c.images.Save(mehmId(created), variants); err != nil {
+			log.Printf("failed saving image variants of mehm %s: %v", mehmId(created), err)
+		}
+		c.decorateMehms(created)
+		created["variants"] = c.variantURLs(mehmId(created))
+	} else {
+		log.Println("mehms service did not return the id of a created mehm, its image variants are dropped")
+	}
+	encodeMehms(w, mehm)
+}
+
+// Image godoc
+// @Summary      Read an image variant
+// @Description  Serves the re-encoded images and thumbnails listed in the variants of a mehm.
+// @Tags         mehms
+// @Produce      image/png,image/jpeg,image/gif
+// @Param        id    path      string  true  "The ID of the mehm"
+// @Param        file  path      string  true  "The file name of the variant"
+// @Success      200  {file}  binary
+// @Failure      404  {object}  errors.ProceduralError
+// @Router       /images/{id}/{file} [get]
+func (c *controller) Image(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	file, err := c.images.Open(vars["id"], vars["file"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		utils.NotFound(w, fmt.Errorf("image %s/%s does not exist", vars["id"], vars["file"]))
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, vars["file"], time.Time{}, file)
+}
+
+// readMehm checks the text fields of the form and reads the image into memory.
+func readMehm(form *multipart.Reader, maxImageSize int64, genres dto.GenreRegistry) (map[string]string, []byte, error) {
+	fields := map[string]string{}
+	var image []byte
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := part.FormName()
+		if _, seen := fields[name]; seen || (name == "image" && image != nil) {
+			return nil, nil, &formError{fmt.Errorf("field %s is given more than once", name)}
+		}
+
+		if name == "image" {
+			image, err = io.ReadAll(media.LimitReader(part, maxImageSize))
+		} else if maxLength, ok := mehmFields[name]; ok {
+			fields[name], err = readField(part, name, maxLength, genres)
+		} else {
+			_, err = io.Copy(io.Discard, part)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if image == nil {
+		return nil, nil, &formError{fmt.Errorf("field image is missing")}
+	}
+	for _, name := range []string{"title", "description", "genre"} {
+		if _, ok := fields[name]; !ok {
+			return nil, nil, &formError{fmt.Errorf("field %s is missing", name)}
+		}
+	}
+	return fields, image, nil
+}
+
+func readField(part *multipart.Part, name string, maxLength int, genres dto.GenreRegistry) (string, error) {
+	raw, err := io.ReadAll(io.LimitReader(part, int64(maxLength)*utf8.UTFMax+1))
+	if err != nil {
+		return "", err
+	}
+	value := string(raw)
+	if length := utf8.RuneCountInString(value); length < 1 || length > maxLength {
+		return "", &formError{fmt.Errorf("%s must be 1-%d signs", name, maxLength)}
+	}
+	if name == "genre" {
+		if _, err = genres.Parse(value); err != nil {
+			return "", &formError{err}
+		}
+	}
+	return value, nil
+}
+
+// mehmForm builds the upload for the mehms service from the checked fields and the processed image.
+func mehmForm(fields map[string]string, image media.Variant) (io.Reader, string, error) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename="image%s"`, media.Extension(image.MimeType)))
+	header.Set("Content-Type", image.MimeType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err = part.Write(image.Data); err != nil {
+		return nil, "", err
+	}
+	for _, name := range []string{"title", "description", "genre"} {
+		if err = mw.WriteField(name, fields[name]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err = mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, mw.FormDataContentType(), nil
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	var fieldErr *formError
+	switch {
+	case errors.As(err, &fieldErr), errors.Is(err, media.ErrTooManyPixels):
+		utils.UnprocessableEntity(w, err)
+	case errors.Is(err, media.ErrUnsupportedType):
+		utils.UnsupportedMediaType(w, err)
+	case errors.Is(err, media.ErrTooLarge):
+		utils.RequestEntityTooLarge(w, err)
+	default:
+		utils.BadRequest(w, err)
+	}
+}
+
+// forwardMehms relays an upstream response holding mehms, adding the URLs of
+// their image variants and naming their genres.
+func (c *controller) forwardMehms(w http.ResponseWriter, res *http.Response, err error) {
+	if err != nil || res.StatusCode != http.StatusOK {
+		forward(w, res, err)
+		return
+	}
+	defer res.Body.Close()
+
+	mehms, err := decodeMehms(res.Body)
+	if err != nil {
+		utils.BadGateway(w, err)
+		return
+	}
+	c.decorateMehms(mehms)
+	encodeMehms(w, mehms)
+}
+
+// decorateMehms walks a decoded payload, so it does not depend on whether the
+// mehms come as a list, a map or a single object.
+func (c *controller) decorateMehms(value interface{}) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			c.decorateMehms(item)
+		}
+	case map[string]interface{}:
+		if _, isMehm := v["imageSource"]; isMehm && mehmId(v) != "" {
+			if urls := c.variantURLs(mehmId(v)); len(urls) > 0 {
+				v["variants"] = urls
+			}
+			if number, ok := v["genre"].(json.Number); ok {
+				if id, err := strconv.ParseUint(number.String(), 10, 8); err == nil {
+					if genre, err := c.genres.Genre(uint8(id)); err == nil {
+						v["genre"] = genre.String()
+					}
+				}
+			}
+			return
+		}
+		for _, item := range v {
+			c.decorateMehms(item)
+		}
+	}
+}
+
+func (c *controller) variantURLs(id string) map[string]string {
+	urls, err := c.images.URLs(id)
+	if err != nil {
+		log.Printf("failed listing image variants of mehm %s: %v", id, err)
+	}
+	return urls
+}
+
+func mehmId(mehm map[string]interface{}) string {
+	switch id := mehm["id"].(type) {
+	case json.Number:
+		return id.String()
+	case string:
+		return id
+	}
+	return ""
+}
+
+func decodeMehms(body io.Reader) (interface{}, error) {
+	var mehms interface{}
+	decoder := json.NewDecoder(io.LimitReader(body, maxMehmResponse))
+	decoder.UseNumber()
+	if err := decoder.Decode(&mehms); err != nil {
+		return nil, fmt.Errorf("invalid response from mehms service: %w", err)
+	}
+	return mehms, nil
+}
+
+func encodeMehms(w http.ResponseWriter, mehms interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(mehms); err != nil {
+		utils.InternalServerError(w, err)
+	}
+}
@@ -0,0 +1,59 @@
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nillga/mehm-services-api-gateway/config"
+)
+
+// NewToken returns a random token for the double-submit cookie.
+func NewToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Cookie carries the token to the browser. It is readable by scripts on
+// purpose, since the client has to repeat it in the CSRF header.
+func Cookie(auth config.Auth, token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     auth.CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   auth.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Check requires requests that carry the auth cookie to repeat the CSRF
+// cookie in the CSRF header. Requests without the auth cookie, or with a
+// bearer token that takes precedence over it, cannot be forged by a browser.
+func Check(auth config.Auth, r *http.Request) error {
+	if !auth.Cookies() {
+		return nil
+	}
+	if _, err := r.Cookie(auth.CookieName); err != nil {
+		return nil
+	}
+	if auth.Bearer() && r.Header.Get("Authorization") != "" {
+		return nil
+	}
+
+	cookie, err := r.Cookie(auth.CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return fmt.Errorf("missing CSRF cookie")
+	}
+	header := r.Header.Get(auth.CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return fmt.Errorf("CSRF token mismatch")
+	}
+	return nil
+}
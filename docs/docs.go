@@ -25,14 +25,853 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/apikeys": {
+            "get": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "This is only usable for privileged users. Secrets are never listed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List API keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/apikey.Key"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "This is only usable for privileged users. Scopes are mehms:read, comments:post and admin. The secret is only returned once, send it as X-API-Key header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "description": "Input data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.APIKeyInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CreatedAPIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/validation.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/apikeys/{id}/revoke": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "This is only usable for privileged users. The key is rejected from the next request on.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Revoke an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ID of the key",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/upstreams": {
+            "get": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "This is only usable for privileged users. An open circuit answers calls with 503 until its cooldown has passed.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Show the state of the upstream circuit breakers",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/upstream.BreakerStatus"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/csrf": {
+            "get": {
+                "description": "Sets a fresh CSRF cookie and returns its value. With cookie authentication, every POST request has to repeat it in the CSRF header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Issue a CSRF token",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/login": {
+            "post": {
+                "description": "Proxied to the users service. If the gateway runs with auth cookies, the issued token is set as HttpOnly cookie instead of being returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Log in",
+                "parameters": [
+                    {
+                        "description": "Input data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.LoginInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/logout": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "Revokes the current token, clears the auth cookie and notifies the users service. Tokens without an id cannot be revoked one by one, so for them every token of the user issued so far is revoked, logging the user out on all devices.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Log out",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/refresh": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "Exchanges the current token, sent as bearer token or auth cookie, for a new one at the users service. Expired and revoked tokens are refused.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh a token",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/signup": {
+            "post": {
+                "description": "Proxied to the users service. Tokens are handled like on login.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Sign up",
+                "parameters": [
+                    {
+                        "description": "Input data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/entity.SignupInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/batch": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
+                    }
+                ],
+                "description": "Every request is authorized like it was sent on its own, with the credentials of the batch. They run concurrently, so a request must not depend on the outcome of another one. The responses are in the order of the requests. Cookies set by a request are dropped. Bodies that are not JSON are returned base64 encoded, marked by encoding. Responses larger than the configured limit are replaced by an error, such requests have to be sent on their own.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "batch"
+                ],
+                "summary": "Run several requests at once",
+                "parameters": [
+                    {
+                        "description": "The requests",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/batch.Request"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/batch.Response"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/validation.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/comments/get/{id}": {
             "get": {
                 "security": [
                     {
                         "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
+                    }
+                ],
+                "description": "By specifying the comment id, you can read that comment. With shape=legacy, or by default on gateways running with LEGACY_COMMENTS, it is shaped like dto.CommentDTO instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Read a specified comment",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "The ID of the requested comment",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "v2",
+                            "legacy"
+                        ],
+                        "type": "string",
+                        "description": "the shape of the comment",
+                        "name": "shape",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.CommentV2"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/comments/new": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
+                    }
+                ],
+                "description": "With this API-Call you are able to post a comment related to any existing Mehm.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Post a comment",
+                "parameters": [
+                    {
+                        "description": "Input data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.Comment"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/validation.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/comments/remove": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "Regular users can only delete their own comments, privileged users can delete whatever they wish",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Delete a Comment",
+                "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "The ID of the requested mehm",
+                        "name": "commentId",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/comments/update": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    }
+                ],
+                "description": "Here you can edit previously posted comments. An Admin will be able to edit other people's comments too.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "comments"
+                ],
+                "summary": "Edit an existing comment",
+                "parameters": [
+                    {
+                        "description": "Input data",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.CommentInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/validation.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    }
+                }
+            }
+        },
+        "/genres": {
+            "get": {
+                "description": "Genres are sent by name, the number is the one the mehms service stores.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "mehms"
+                ],
+                "summary": "List the genres",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.GenreDTO"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql": {
+            "post": {
+                "security": [
+                    {
+                        "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
                     }
                 ],
-                "description": "By specifying the comment id, you can read that comment",
+                "description": "The schema is served by introspection, which like the genres needs no credentials. Invalid credentials are refused with 401 though. An operation selects at most 10 root fields and 500 fields in total, fragments expanded, otherwise it is rejected with 422 before it runs. Every field and mutation needs the same permission as its REST route and calls the same upstream. Errors carry the status the REST route would have answered with in their extensions.",
                 "consumes": [
                     "application/json"
                 ],
@@ -40,46 +879,85 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "graphql"
                 ],
-                "summary": "Read a specified comment",
+                "summary": "Query mehms, comments and users with GraphQL",
                 "parameters": [
                     {
-                        "minimum": 1,
-                        "type": "integer",
-                        "description": "The ID of the requested comment",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "The query",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.GraphQLRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.CommentDTO"
+                            "type": "object"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/validation.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/{id}/{file}": {
+            "get": {
+                "description": "Serves the re-encoded images and thumbnails listed in the variants of a mehm.",
+                "produces": [
+                    "image/png",
+                    "image/jpeg",
+                    "image/gif"
+                ],
+                "tags": [
+                    "mehms"
+                ],
+                "summary": "Read an image variant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ID of the mehm",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "The file name of the variant",
+                        "name": "file",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
                         }
                     },
-                    "502": {
-                        "description": "Bad Gateway",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
@@ -87,14 +965,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/comments/new": {
-            "post": {
+        "/mehms": {
+            "get": {
                 "security": [
                     {
                         "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
                     }
                 ],
-                "description": "With this API-Call you are able to post a comment related to any existing Mehm.",
+                "description": "Pagination can be handled via query parameters",
                 "consumes": [
                     "application/json"
                 ],
@@ -102,31 +983,67 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "mehms"
                 ],
-                "summary": "Post a comment",
+                "summary": "Read a page of mehms",
                 "parameters": [
                     {
-                        "description": "Input data",
-                        "name": "input",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.Comment"
-                        }
+                        "minimum": 0,
+                        "type": "integer",
+                        "default": 0,
+                        "description": "states the number of skipped Mehms",
+                        "name": "skip",
+                        "in": "query"
+                    },
+                    {
+                        "maximum": 30,
+                        "minimum": 1,
+                        "type": "integer",
+                        "default": 30,
+                        "description": "states the count of grabbed Mehms",
+                        "name": "take",
+                        "in": "query"
+                    },
+                    {
+                        "maxLength": 32,
+                        "minLength": 0,
+                        "type": "string",
+                        "default": "",
+                        "description": "search a Mehm by name",
+                        "name": "textSearch",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "filter for a genre by name, GET /genres lists them",
+                        "name": "genre",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "createdDate",
+                            "likes"
+                        ],
+                        "type": "string",
+                        "description": "sort the results",
+                        "name": "sort",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/dto.MehmDTO"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/validation.Error"
                         }
                     },
                     "401": {
@@ -140,41 +1057,59 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
-                    },
-                    "502": {
-                        "description": "Bad Gateway",
-                        "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
-                        }
                     }
                 }
             }
         },
-        "/comments/remove": {
+        "/mehms/new": {
             "post": {
                 "security": [
                     {
                         "bearerToken": []
                     }
                 ],
-                "description": "Regular users can only delete their own comments, privileged users can delete whatever they wish",
+                "description": "The image has to be a PNG, JPEG, GIF or WebP file. Its format is detected from its content, not from the declared content type. The gateway strips all metadata, re-encodes the image and adds thumbnails to the mehm's variants.",
                 "consumes": [
-                    "application/json"
+                    "multipart/form-data"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "mehms"
                 ],
-                "summary": "Delete a Comment",
+                "summary": "Upload a new mehm",
                 "parameters": [
                     {
-                        "minimum": 1,
-                        "type": "integer",
-                        "description": "The ID of the requested mehm",
-                        "name": "commentId",
-                        "in": "query",
+                        "type": "file",
+                        "description": "The image of the mehm",
+                        "name": "image",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "maxLength": 32,
+                        "minLength": 1,
+                        "type": "string",
+                        "description": "The title of the mehm",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "maxLength": 128,
+                        "minLength": 1,
+                        "type": "string",
+                        "description": "The description of the mehm",
+                        "name": "description",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "The name of the genre of the mehm, GET /genres lists them",
+                        "name": "genre",
+                        "in": "formData",
                         "required": true
                     }
                 ],
@@ -182,7 +1117,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/dto.MehmDTO"
                         }
                     },
                     "400": {
@@ -197,8 +1132,20 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
@@ -212,14 +1159,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/comments/update": {
-            "post": {
+        "/mehms/{id}": {
+            "get": {
                 "security": [
                     {
                         "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
                     }
                 ],
-                "description": "Here you can edit previously posted comments. An Admin will be able to edit other people's comments too.",
+                "description": "This will return the requested Mehm including the information whether you have liked it already.",
                 "consumes": [
                     "application/json"
                 ],
@@ -227,25 +1177,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "comments"
+                    "mehms"
                 ],
-                "summary": "Edit an existing comment",
+                "summary": "View a specified mehm",
                 "parameters": [
                     {
-                        "description": "Input data",
-                        "name": "input",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.CommentInput"
-                        }
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "The ID of the requested mehm",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object"
+                            "$ref": "#/definitions/dto.MehmDTO"
                         }
                     },
                     "400": {
@@ -260,18 +1209,6 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "403": {
-                        "description": "Forbidden",
-                        "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
-                        }
-                    },
-                    "422": {
-                        "description": "Unprocessable Entity",
-                        "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
-                        }
-                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -287,14 +1224,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/mehms": {
+        "/mehms/{id}/comments": {
             "get": {
                 "security": [
                     {
                         "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
                     }
                 ],
-                "description": "Pagination can be handled via query parameters",
+                "description": "Comments are paged by skip and take and shaped like dto.CommentV2 or, with shape=legacy, like dto.CommentDTO. Without shape, the gateway's default applies. X-Total-Count holds the number of all comments of the mehm if the mehms service tells it, the Link header points to the neighbouring pages.",
                 "consumes": [
                     "application/json"
                 ],
@@ -302,56 +1242,54 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "mehms"
+                    "comments"
                 ],
-                "summary": "Read a page of mehms",
+                "summary": "Read the comments of a mehm",
                 "parameters": [
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "description": "The ID of the mehm",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "minimum": 0,
                         "type": "integer",
                         "default": 0,
-                        "description": "states the number of skipped Mehms",
+                        "description": "states the number of skipped comments",
                         "name": "skip",
                         "in": "query"
                     },
                     {
-                        "maximum": 30,
+                        "maximum": 50,
                         "minimum": 1,
                         "type": "integer",
-                        "default": 30,
-                        "description": "states the count of grabbed Mehms",
+                        "default": 20,
+                        "description": "states the count of grabbed comments",
                         "name": "take",
                         "in": "query"
                     },
-                    {
-                        "maxLength": 32,
-                        "minLength": 0,
-                        "type": "string",
-                        "default": "",
-                        "description": "search a Mehm by name",
-                        "name": "textSearch",
-                        "in": "query"
-                    },
                     {
                         "enum": [
-                            "PROGRAMMING",
-                            "DHBW",
-                            "OTHER",
-                            ""
+                            "createdDate",
+                            "-createdDate"
                         ],
                         "type": "string",
-                        "description": "filter for a genre",
-                        "name": "genre",
+                        "default": "createdDate",
+                        "description": "sort by creation, oldest first or with - newest first",
+                        "name": "sort",
                         "in": "query"
                     },
                     {
                         "enum": [
-                            "createdDate",
-                            "likes"
+                            "v2",
+                            "legacy"
                         ],
                         "type": "string",
-                        "description": "sort the results",
-                        "name": "sort",
+                        "description": "the shape of the comments",
+                        "name": "shape",
                         "in": "query"
                     }
                 ],
@@ -359,16 +1297,26 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "$ref": "#/definitions/dto.MehmDTO"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.CommentV2"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URLs of the next and previous page"
+                            },
+                            "X-Total-Count": {
+                                "type": "int",
+                                "description": "number of all comments of the mehm"
                             }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/validation.Error"
                         }
                     },
                     "401": {
@@ -377,8 +1325,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "502": {
+                        "description": "Bad Gateway",
                         "schema": {
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
@@ -386,14 +1334,17 @@ const docTemplate = `{
                 }
             }
         },
-        "/mehms/{id}": {
+        "/mehms/{id}/full": {
             "get": {
                 "security": [
                     {
                         "bearerToken": []
+                    },
+                    {
+                        "apiKey": []
                     }
                 ],
-                "description": "This will return the requested Mehm including the information whether you have liked it already.",
+                "description": "Combines GetSpecificMehm, the first page of its comments and the public profiles of the authors of both. The mehms and users services are asked at the same time. If the comments or the authors cannot be read, the other parts are still returned and errors tells which part is missing. Only if the mehm itself cannot be read, the request fails with the status of that part.",
                 "consumes": [
                     "application/json"
                 ],
@@ -403,7 +1354,7 @@ const docTemplate = `{
                 "tags": [
                     "mehms"
                 ],
-                "summary": "View a specified mehm",
+                "summary": "View a mehm with its comments and authors",
                 "parameters": [
                     {
                         "minimum": 1,
@@ -412,13 +1363,23 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "enum": [
+                            "v2",
+                            "legacy"
+                        ],
+                        "type": "string",
+                        "description": "the shape of the comments",
+                        "name": "shape",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/dto.MehmDTO"
+                            "$ref": "#/definitions/dto.MehmDetail"
                         }
                     },
                     "400": {
@@ -433,16 +1394,16 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/dto.MehmDetail"
                         }
                     },
                     "502": {
                         "description": "Bad Gateway",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/dto.MehmDetail"
                         }
                     }
                 }
@@ -647,10 +1608,16 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/validation.Error"
                         }
                     },
                     "500": {
@@ -742,6 +1709,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -805,10 +1778,16 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
                     "422": {
                         "description": "Unprocessable Entity",
                         "schema": {
-                            "$ref": "#/definitions/errors.ProceduralError"
+                            "$ref": "#/definitions/validation.Error"
                         }
                     },
                     "500": {
@@ -870,6 +1849,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/errors.ProceduralError"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/errors.ProceduralError"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -881,28 +1866,105 @@ const docTemplate = `{
         }
     },
     "definitions": {
-        "dto.Comment": {
+        "apikey.Key": {
             "type": "object",
             "properties": {
-                "comment": {
+                "createdAt": {
                     "type": "string"
                 },
-                "mehmId": {
-                    "type": "integer"
+                "createdBy": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "batch.Request": {
+            "type": "object",
+            "properties": {
+                "body": {
+                    "type": "object"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
                 }
             }
         },
-        "dto.CommentDTO": {
+        "batch.Response": {
             "type": "object",
             "properties": {
-                "author": {
+                "body": {
+                    "type": "object"
+                },
+                "encoding": {
+                    "type": "string"
+                },
+                "header": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
                     "type": "string"
                 },
-                "dateTime": {
+                "status": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.APIKeyInput": {
+            "type": "object",
+            "properties": {
+                "name": {
                     "type": "string"
                 },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.Author": {
+            "type": "object",
+            "properties": {
                 "id": {
                     "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.Comment": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string"
+                },
+                "mehmId": {
+                    "type": "integer"
                 }
             }
         },
@@ -918,6 +1980,87 @@ const docTemplate = `{
                 }
             }
         },
+        "dto.CommentV2": {
+            "type": "object",
+            "properties": {
+                "authorId": {
+                    "type": "string"
+                },
+                "authorName": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "editedAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mehmId": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.CreatedAPIKey": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "createdBy": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.GenreDTO": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "dto.GraphQLRequest": {
+            "type": "object",
+            "properties": {
+                "operationName": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
         "dto.MehmDTO": {
             "type": "object",
             "properties": {
@@ -931,7 +2074,7 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "genre": {
-                    "type": "integer"
+                    "type": "string"
                 },
                 "id": {
                     "type": "integer"
@@ -944,6 +2087,51 @@ const docTemplate = `{
                 },
                 "title": {
                     "type": "string"
+                },
+                "variants": {
+                    "description": "Variants maps the names of the processed images, like \"original\" or\n\"w160\" for a thumbnail 160 pixels wide, to their URLs.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "dto.MehmDetail": {
+            "type": "object",
+            "properties": {
+                "authors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.Author"
+                    }
+                },
+                "comments": {},
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.PartError"
+                    }
+                },
+                "mehm": {
+                    "description": "Mehm is shaped like MehmDTO, Comments like CommentV2 or, with\nshape=legacy, like CommentDTO."
+                },
+                "totalComments": {
+                    "type": "integer"
+                }
+            }
+        },
+        "dto.PartError": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "part": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
                 }
             }
         },
@@ -955,6 +2143,34 @@ const docTemplate = `{
                 }
             }
         },
+        "entity.LoginInput": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "entity.SignupInput": {
+            "type": "object",
+            "properties": {
+                "mail": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "repeated": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
         "entity.User": {
             "type": "object",
             "properties": {
@@ -985,9 +2201,62 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "upstream.BreakerStatus": {
+            "type": "object",
+            "properties": {
+                "consecutiveFailures": {
+                    "type": "integer"
+                },
+                "openedAt": {
+                    "type": "string"
+                },
+                "retryAfterSeconds": {
+                    "type": "integer"
+                },
+                "state": {
+                    "type": "string"
+                },
+                "upstream": {
+                    "type": "string"
+                }
+            }
+        },
+        "validation.Error": {
+            "type": "object",
+            "properties": {
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.FieldError"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "validation.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
+        "apiKey": {
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
         "bearerToken": {
             "type": "apiKey",
             "name": "Authorization",
@@ -1,13 +1,11 @@
 package dto
 
-import "time"
+import (
+	"net/url"
+	"strconv"
+	"time"
 
-type Genre uint8
-
-const (
-	PROGRAMMING Genre = iota
-	DHBW
-	OTHER
+	"github.com/nillga/mehm-services-api-gateway/apikey"
 )
 
 type MehmDTO struct {
@@ -17,16 +15,101 @@ type MehmDTO struct {
 	Description string    `json:"description"`
 	ImageSource string    `json:"imageSource"`
 	CreatedDate time.Time `json:"createdDate"`
-	Genre       Genre     `json:"genre"`
+	Genre       Genre     `json:"genre" swaggertype:"string"`
 	Likes       int       `json:"likes"`
+	// Variants maps the names of the processed images, like "original" or
+	// "w160" for a thumbnail 160 pixels wide, to their URLs.
+	Variants map[string]string `json:"variants,omitempty"`
+}
+
+// FeedQuery is the contract of the mehm feed. Other query parameters are not forwarded.
+type FeedQuery struct {
+	Skip       int    `query:"skip" minimum:"0"`
+	Take       int    `query:"take" minimum:"1" maximum:"30"`
+	TextSearch string `query:"textSearch" maxlength:"32"`
+	Sort       string `query:"sort" enum:"createdDate,likes"`
+	Genre      *Genre `query:"genre"`
+}
+
+func NewFeedQuery() FeedQuery {
+	return FeedQuery{Take: 30}
+}
+
+// Values renders the query for the mehms service.
+func (q FeedQuery) Values() url.Values {
+	values := url.Values{
+		"skip": {strconv.Itoa(q.Skip)},
+		"take": {strconv.Itoa(q.Take)},
+	}
+	if q.TextSearch != "" {
+		values.Set("textSearch", q.TextSearch)
+	}
+	if q.Sort != "" {
+		values.Set("sort", q.Sort)
+	}
+	if q.Genre != nil {
+		values.Set("genre", q.Genre.String())
+	}
+	return values
+}
+
+// CommentQuery pages through the comments of a mehm.
+type CommentQuery struct {
+	Skip int    `query:"skip" minimum:"0"`
+	Take int    `query:"take" minimum:"1" maximum:"50"`
+	Sort string `query:"sort" enum:"createdDate,-createdDate"`
+}
+
+func NewCommentQuery() CommentQuery {
+	return CommentQuery{Take: 20, Sort: "createdDate"}
+}
+
+func (q CommentQuery) Values() url.Values {
+	return url.Values{
+		"skip": {strconv.Itoa(q.Skip)},
+		"take": {strconv.Itoa(q.Take)},
+		"sort": {q.Sort},
+	}
 }
 
+// CommentDTO is the legacy comment shape the mehms service sends, served
+// with shape=legacy or by default with LEGACY_COMMENTS. It carries the text
+// under "id" and cannot address the comment.
 type CommentDTO struct {
 	Comment  string    `json:"id"`
 	Author   string    `json:"author"`
 	DateTime time.Time `json:"dateTime"`
 }
 
+// V2 carries a legacy comment over. The ids it lacks stay zero for the
+// gateway to fill in from the request.
+func (c CommentDTO) V2() CommentV2 {
+	return CommentV2{
+		AuthorName: c.Author,
+		Text:       c.Comment,
+		CreatedAt:  c.DateTime,
+	}
+}
+
+// CommentV2 is the comment response model.
+type CommentV2 struct {
+	Id         int64      `json:"id"`
+	MehmId     int64      `json:"mehmId"`
+	AuthorId   string     `json:"authorId"`
+	AuthorName string     `json:"authorName"`
+	Text       string     `json:"text"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	EditedAt   *time.Time `json:"editedAt"`
+}
+
+func (c CommentV2) Legacy() CommentDTO {
+	return CommentDTO{
+		Comment:  c.Text,
+		Author:   c.AuthorName,
+		DateTime: c.CreatedAt,
+	}
+}
+
 type CommentInput struct {
 	Id      int64  `json:"id" minimum:"1"`
 	Comment string `json:"text" minlength:"1" maxlength:"256"`
@@ -41,3 +124,45 @@ type MehmInput struct {
 	Description string `json:"description" minlength:"1" maxlength:"128"`
 	Title       string `json:"title" minlength:"1" maxlength:"32"`
 }
+
+type APIKeyInput struct {
+	Name   string         `json:"name" minlength:"1" maxlength:"64"`
+	Scopes []apikey.Scope `json:"scopes" minlength:"1"`
+}
+
+// CreatedAPIKey is the only response that carries the secret of a key.
+type CreatedAPIKey struct {
+	apikey.Key
+	Secret string `json:"secret"`
+}
+
+// MehmDetail bundles everything the detail page of a mehm shows. Parts whose
+// backend failed are left out and described in Errors instead.
+type MehmDetail struct {
+	// Mehm is shaped like MehmDTO, Comments like CommentV2 or, with
+	// shape=legacy, like CommentDTO.
+	Mehm          interface{} `json:"mehm,omitempty"`
+	Comments      interface{} `json:"comments,omitempty"`
+	TotalComments *int        `json:"totalComments,omitempty"`
+	Authors       []Author    `json:"authors,omitempty"`
+	Errors        []PartError `json:"errors,omitempty"`
+}
+
+// Author is the public part of a user, without the email address.
+type Author struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PartError tells which part of a composite response is missing and why.
+type PartError struct {
+	Part    string `json:"part"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query" minlength:"1"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
@@ -0,0 +1,145 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var errNoRegistry = errors.New("genre is not from a registry")
+
+// Genre is numbered by the mehms service and named towards clients. Genres
+// come from a GenreRegistry, which knows their names.
+type Genre struct {
+	id       uint8
+	registry *genreRegistry
+}
+
+// GenreRegistry holds the genres configured for the gateway.
+type GenreRegistry interface {
+	// Genres lists the genres in the order of their numbers.
+	Genres() []GenreDTO
+	// Parse looks a genre up by its name.
+	Parse(name string) (Genre, error)
+	// Genre looks a genre up by the number the mehms service stores.
+	Genre(id uint8) (Genre, error)
+}
+
+type genreRegistry struct {
+	names []string
+	ids   map[string]uint8
+}
+
+// NewGenreRegistry numbers the genres by their position, so genres may only
+// be appended to keep the numbers of the mehms service.
+func NewGenreRegistry(names []string) (GenreRegistry, error) {
+	if len(names) == 0 || len(names) > math.MaxUint8+1 {
+		return nil, fmt.Errorf("between 1 and %d genres are needed", math.MaxUint8+1)
+	}
+	ids := make(map[string]uint8, len(names))
+	for i, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("genre %d has no name", i)
+		}
+		if _, ok := ids[name]; ok {
+			return nil, fmt.Errorf("genre %s is given more than once", name)
+		}
+		ids[name] = uint8(i)
+	}
+	return &genreRegistry{names: append([]string(nil), names...), ids: ids}, nil
+}
+
+func (r *genreRegistry) Genres() []GenreDTO {
+	genres := make([]GenreDTO, len(r.names))
+	for i, name := range r.names {
+		genres[i] = GenreDTO{Id: uint8(i), Name: name}
+	}
+	return genres
+}
+
+func (r *genreRegistry) Parse(name string) (Genre, error) {
+	id, ok := r.ids[name]
+	if !ok {
+		return Genre{}, fmt.Errorf("invalid genre %s", name)
+	}
+	return Genre{id: id, registry: r}, nil
+}
+
+func (r *genreRegistry) Genre(id uint8) (Genre, error) {
+	if int(id) >= len(r.names) {
+		return Genre{}, fmt.Errorf("invalid genre %d", id)
+	}
+	return Genre{id: id, registry: r}, nil
+}
+
+// Id is the number the mehms service stores.
+func (g Genre) Id() uint8 {
+	return g.id
+}
+
+// String names the genre, or numbers it if it is not from a registry.
+func (g Genre) String() string {
+	if g.registry == nil {
+		return strconv.Itoa(int(g.id))
+	}
+	return g.registry.names[g.id]
+}
+
+// MarshalText fails for genres not from a registry, as their name is unknown.
+func (g Genre) MarshalText() ([]byte, error) {
+	if g.registry == nil {
+		return nil, fmt.Errorf("genre %d: %w", g.id, errNoRegistry)
+	}
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText looks the name up in the registry g is from, so g has to be
+// taken from a GenreRegistry first.
+func (g *Genre) UnmarshalText(text []byte) error {
+	if g.registry == nil {
+		return errNoRegistry
+	}
+	genre, err := g.registry.Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*g = genre
+	return nil
+}
+
+func (g Genre) MarshalJSON() ([]byte, error) {
+	text, err := g.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON accepts names as well as the numbers the mehms service sends,
+// as long as the registry g is from knows them.
+func (g *Genre) UnmarshalJSON(data []byte) error {
+	if g.registry == nil {
+		return errNoRegistry
+	}
+	var number uint8
+	if err := json.Unmarshal(data, &number); err == nil {
+		genre, err := g.registry.Genre(number)
+		if err != nil {
+			return err
+		}
+		*g = genre
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("genre must be a name or a number: %w", err)
+	}
+	return g.UnmarshalText([]byte(name))
+}
+
+type GenreDTO struct {
+	Id   uint8  `json:"id"`
+	Name string `json:"name"`
+}
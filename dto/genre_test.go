@@ -0,0 +1,132 @@
+package dto
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewGenreRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr string
+	}{
+		{name: "valid", names: []string{"PROGRAMMING", "DHBW", "OTHER"}},
+		{name: "empty", wantErr: "between 1 and 256 genres are needed"},
+		{name: "too many", names: make([]string, 257), wantErr: "between 1 and 256 genres are needed"},
+		{name: "without name", names: []string{"DHBW", ""}, wantErr: "genre 1 has no name"},
+		{name: "duplicate", names: []string{"DHBW", "OTHER", "DHBW"}, wantErr: "genre DHBW is given more than once"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewGenreRegistry(test.names)
+			if test.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("NewGenreRegistry() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenreRegistry(t *testing.T) {
+	names := []string{"PROGRAMMING", "DHBW"}
+	genres, err := NewGenreRegistry(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// registries do not share the slice they are built from
+	names[0] = "CHANGED"
+
+	want := []GenreDTO{{Id: 0, Name: "PROGRAMMING"}, {Id: 1, Name: "DHBW"}}
+	if got := genres.Genres(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Genres() = %v, want %v", got, want)
+	}
+
+	dhbw, err := genres.Parse("DHBW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dhbw.Id() != 1 || dhbw.String() != "DHBW" {
+		t.Errorf("Parse() = %d %s, want 1 DHBW", dhbw.Id(), dhbw)
+	}
+	if byId, err := genres.Genre(1); err != nil || byId != dhbw {
+		t.Errorf("Genre(1) = %v, %v, want DHBW", byId, err)
+	}
+	if _, err = genres.Parse("dhbw"); err == nil {
+		t.Errorf("names are matched case-insensitively")
+	}
+	if _, err = genres.Genre(2); err == nil {
+		t.Errorf("unknown number was accepted")
+	}
+}
+
+func TestGenreJSON(t *testing.T) {
+	genres, err := NewGenreRegistry([]string{"PROGRAMMING", "DHBW", "OTHER"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := genres.Parse("OTHER")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "name", input: `"DHBW"`, want: "DHBW"},
+		{name: "number of the mehms service", input: `2`, want: "OTHER"},
+		{name: "unknown name", input: `"MEMES"`, wantErr: "invalid genre MEMES"},
+		{name: "unknown number", input: `3`, wantErr: "invalid genre 3"},
+		{name: "neither", input: `true`, wantErr: "genre must be a name or a number"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			genre := other
+			err := json.Unmarshal([]byte(test.input), &genre)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if genre.String() != test.want {
+				t.Errorf("Unmarshal() = %s, want %s", genre, test.want)
+			}
+
+			// genres are written by name and read back the same
+			encoded, err := json.Marshal(genre)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(encoded) != `"`+test.want+`"` {
+				t.Errorf("Marshal() = %s, want %q", encoded, test.want)
+			}
+			again := other
+			if err = json.Unmarshal(encoded, &again); err != nil || again != genre {
+				t.Errorf("round trip = %v, %v, want %s", again, err, genre)
+			}
+		})
+	}
+}
+
+func TestGenreWithoutRegistry(t *testing.T) {
+	var genre Genre
+	if _, err := json.Marshal(genre); err == nil {
+		t.Errorf("genre without a name was written")
+	}
+	if err := json.Unmarshal([]byte(`"DHBW"`), &genre); err == nil {
+		t.Errorf("genre was read without a registry")
+	}
+	if genre.String() != "0" {
+		t.Errorf("String() = %s, want its number", genre)
+	}
+}
@@ -1,13 +1,17 @@
 module github.com/nillga/mehm-services-api-gateway
 
-go 1.17
+go 1.19
 
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/go-chi/chi v1.5.4
 	github.com/gorilla/mux v1.8.0
+	github.com/graph-gophers/dataloader v5.0.0+incompatible
+	github.com/graph-gophers/graphql-go v1.3.0
 	github.com/nillga/jwt-server v0.0.0-20220320181401-b4523e50d872
 	github.com/swaggo/http-swagger v1.2.5
+	golang.org/x/image v0.18.0
+	golang.org/x/sync v0.7.0
 )
 
 require (
@@ -20,12 +24,12 @@ require (
 	github.com/go-openapi/swag v0.19.15 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.6 // indirect
+	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/rs/cors v1.8.2
 	github.com/swaggo/files v0.0.0-20210815190702-a29dd2bc99b2 // indirect
-	github.com/swaggo/swag v1.7.9 // indirect
-	golang.org/x/net v0.0.0-20210805182204-aaa1db679c0d // indirect
-	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
-	golang.org/x/text v0.3.7 // indirect
-	golang.org/x/tools v0.1.7 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/swaggo/swag v1.7.9
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Dependency is a backend the gateway needs in order to serve requests.
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type DependencyStatus struct {
+	Status    string    `json:"status"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies,omitempty"`
+}
+
+type Checker interface {
+	Liveness(w http.ResponseWriter, r *http.Request)
+	Readiness(w http.ResponseWriter, r *http.Request)
+}
+
+type Options struct {
+	// Timeout bounds a single dependency probe.
+	Timeout time.Duration
+	// CacheTTL is how long a probe result is reused before the dependency is probed again.
+	CacheTTL time.Duration
+}
+
+type probe struct {
+	Dependency
+
+	mu     sync.Mutex
+	last   DependencyStatus
+	probed bool
+}
+
+type checker struct {
+	ready  func() bool
+	opts   Options
+	probes []*probe
+}
+
+// NewChecker reports the gateway ready while ready returns true and every dependency answers.
+func NewChecker(ready func() bool, opts Options, dependencies ...Dependency) Checker {
+	probes := make([]*probe, len(dependencies))
+	for i, dependency := range dependencies {
+		probes[i] = &probe{Dependency: dependency}
+	}
+	return &checker{ready: ready, opts: opts, probes: probes}
+}
+
+func (c *checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Report{Status: "alive"})
+}
+
+func (c *checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !c.ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(Report{Status: "draining"})
+		return
+	}
+
+	report := Report{Status: "ready", Dependencies: make(map[string]DependencyStatus, len(c.probes))}
+	results := make([]DependencyStatus, len(c.probes))
+
+	var wg sync.WaitGroup
+	for i, p := range c.probes {
+		wg.Add(1)
+		go func(i int, p *probe) {
+			defer wg.Done()
+			results[i] = p.status(c.opts)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i, p := range c.probes {
+		report.Dependencies[p.Name] = results[i]
+		if results[i].Status != "up" {
+			report.Status = "unready"
+		}
+	}
+
+	if report.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// status returns the cached probe result or probes the dependency once for all concurrent callers.
+// The probe is not bound to the readiness request, whose caller may give up on
+// it, and a probe that was canceled anyway is not cached.
+func (p *probe) status(opts Options) DependencyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.probed && time.Since(p.last.CheckedAt) < opts.CacheTTL {
+		return p.last
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Check(ctx)
+	status := DependencyStatus{
+		Status:    "up",
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+	if !errors.Is(err, context.Canceled) {
+		p.last, p.probed = status, true
+	}
+
+	return status
+}
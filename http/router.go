@@ -1,43 +1,117 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/csrf"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/service"
+	"github.com/nillga/mehm-services-api-gateway/utils"
 	"github.com/rs/cors"
 )
 
 type ApiGatewayRouter interface {
-	GET(uri string, f func(w http.ResponseWriter, r *http.Request))
-	POST(uri string, f func(w http.ResponseWriter, r *http.Request))
-	SERVE(port string)
+	GET(uri string, permission policy.Permission, f func(w http.ResponseWriter, r *http.Request))
+	POST(uri string, permission policy.Permission, f func(w http.ResponseWriter, r *http.Request))
+	HANDLER() http.Handler
 }
 
-type muxRouter struct{}
-
-var router = mux.NewRouter()
+type muxRouter struct {
+	router         *mux.Router
+	service        service.ApiGatewayService
+	policy         policy.Policy
+	auth           config.Auth
+	allowedOrigins []string
+}
 
-func NewApiGatewayRouter() ApiGatewayRouter {
-	return &muxRouter{}
+func NewApiGatewayRouter(cfg *config.Config, apiGatewayService service.ApiGatewayService, accessPolicy policy.Policy) ApiGatewayRouter {
+	return &muxRouter{
+		router:         mux.NewRouter(),
+		service:        apiGatewayService,
+		policy:         accessPolicy,
+		auth:           cfg.Auth,
+		allowedOrigins: cfg.CORS.AllowedOrigins,
+	}
 }
 
-func (m *muxRouter) GET(uri string, f func(w http.ResponseWriter, r *http.Request)) {
-	router.HandleFunc(uri, f).Methods("GET").Schemes("http")
+func (m *muxRouter) GET(uri string, permission policy.Permission, f func(w http.ResponseWriter, r *http.Request)) {
+	m.router.HandleFunc(uri, m.authorize(permission, f)).Methods("GET").Schemes("http")
 }
 
-func (m *muxRouter) POST(uri string, f func(w http.ResponseWriter, r *http.Request)) {
-	router.HandleFunc(uri, f).Methods("POST").Schemes("http")
+func (m *muxRouter) POST(uri string, permission policy.Permission, f func(w http.ResponseWriter, r *http.Request)) {
+	m.router.HandleFunc(uri, m.checkCSRF(m.authorize(permission, f))).Methods("POST").Schemes("http")
 }
 
-func (m *muxRouter) SERVE(port string) {
+func (m *muxRouter) HANDLER() http.Handler {
 	c := cors.New(cors.Options{
-		AllowedHeaders: []string{"Authorization", "Credentials", "Cookie"},
+		AllowedOrigins:   m.allowedOrigins,
+		AllowedHeaders:   []string{"Authorization", "Credentials", "Cookie", m.auth.CSRFHeader, service.APIKeyHeader},
+		ExposedHeaders:   []string{"X-Total-Count", "Link", "Retry-After"},
+		AllowCredentials: m.auth.Cookies(),
 	})
 	l := log.Logger{}
 	l.SetOutput(os.Stdout)
 	c.Log = &l
 
-	log.Fatalln(http.ListenAndServe(":"+port, c.Handler(router)))
+	return c.Handler(m.router)
+}
+
+// authorize resolves the caller once per request, checks the route's permission
+// and hands the caller to f through the request context.
+func (m *muxRouter) authorize(permission policy.Permission, f func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	if permission == policy.Public {
+		return f
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, key, err := m.service.AuthenticateAPIKey(r)
+		if err == nil && key == nil {
+			user, err = m.service.AuthenticateRequest(r)
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", challenge(err))
+			utils.Unauthorized(w, err)
+			return
+		}
+
+		ctx := service.WithUser(r.Context(), user)
+		if key != nil {
+			ctx = service.WithAPIKey(ctx, key)
+		}
+		if service.Scope(ctx, m.policy, permission) == policy.None {
+			w.Header().Set("Content-Type", "application/json")
+			utils.Forbidden(w, fmt.Errorf("missing permission %s", permission))
+			return
+		}
+
+		f(w, r.WithContext(ctx))
+	}
+}
+
+// checkCSRF rejects state changing requests authenticated by cookie that do not prove same-origin.
+func (m *muxRouter) checkCSRF(f func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := csrf.Check(m.auth, r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			utils.Forbidden(w, err)
+			return
+		}
+		f(w, r)
+	}
+}
+
+// challenge tells OAuth-aware clients whether a token was presented and why it was rejected.
+func challenge(err error) string {
+	if errors.Is(err, service.ErrMissingCredentials) {
+		return "Bearer"
+	}
+	return fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, strings.ReplaceAll(err.Error(), `"`, "'"))
 }
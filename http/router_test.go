@@ -0,0 +1,316 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/service"
+)
+
+// fakeService knows a fixed set of tokens and API keys.
+type fakeService struct {
+	auth   config.Auth
+	tokens map[string]*entity.User
+	keys   map[string]*apikey.Key
+}
+
+func (s *fakeService) Authenticate(authorizationHeader string) (*entity.User, error) {
+	return s.user(strings.TrimPrefix(authorizationHeader, "Bearer "))
+}
+
+func (s *fakeService) AuthenticateRequest(r *http.Request) (*entity.User, error) {
+	token, err := s.TokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.user(token)
+}
+
+func (s *fakeService) TokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); s.auth.Bearer() && (header != "" || !s.auth.Cookies()) {
+		if header == "" {
+			return "", service.ErrMissingCredentials
+		}
+		return strings.TrimPrefix(header, "Bearer "), nil
+	}
+	cookie, err := r.Cookie(s.auth.CookieName)
+	if err != nil {
+		return "", service.ErrMissingCredentials
+	}
+	return cookie.Value, nil
+}
+
+func (s *fakeService) Verify(token string) (*service.Claims, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeService) RevokeToken(claims *service.Claims) error {
+	return errors.New("not implemented")
+}
+
+func (s *fakeService) RevokeUser(userId string) error {
+	return errors.New("not implemented")
+}
+
+func (s *fakeService) AuthenticateAPIKey(r *http.Request) (*entity.User, *apikey.Key, error) {
+	secret := r.Header.Get(service.APIKeyHeader)
+	if secret == "" {
+		return nil, nil, nil
+	}
+	key, ok := s.keys[secret]
+	if !ok {
+		return nil, nil, apikey.ErrInvalidKey
+	}
+	return &entity.User{Id: "apikey:" + key.Id, Admin: key.HasScope(apikey.Admin)}, key, nil
+}
+
+func (s *fakeService) user(token string) (*entity.User, error) {
+	user, ok := s.tokens[token]
+	if !ok {
+		return nil, service.ErrInvalidSignature
+	}
+	return user, nil
+}
+
+func newTestRouter(t *testing.T, mode string) ApiGatewayRouter {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Auth.Mode = mode
+	cfg.CORS.AllowedOrigins = []string{"https://mehms.example"}
+	accessPolicy, err := policy.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeService{
+		auth: cfg.Auth,
+		tokens: map[string]*entity.User{
+			"user-token":  {Id: "1", Username: "user"},
+			"admin-token": {Id: "2", Username: "admin", Admin: true},
+		},
+		keys: map[string]*apikey.Key{
+			"read-key":  {Id: "k1", Scopes: []apikey.Scope{apikey.ReadMehms}},
+			"admin-key": {Id: "k2", Scopes: []apikey.Scope{apikey.Admin}},
+		},
+	}
+
+	router := NewApiGatewayRouter(cfg, fake, accessPolicy)
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := service.UserFromContext(r.Context()); ok {
+			w.Write([]byte(user.Id))
+		}
+	}
+	router.GET("/public", policy.Public, echo)
+	router.GET("/mehms", policy.ReadMehms, echo)
+	router.POST("/mehms", policy.PostMehms, echo)
+	router.GET("/users", policy.ListUsers, echo)
+	return router
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		header    http.Header
+		want      int
+		wantUser  string
+		challenge string
+	}{
+		{name: "public route without credentials", method: http.MethodGet, path: "/public", want: http.StatusOK},
+		{name: "missing credentials", method: http.MethodGet, path: "/mehms", want: http.StatusUnauthorized, challenge: "Bearer"},
+		{
+			name:      "invalid token",
+			method:    http.MethodGet,
+			path:      "/mehms",
+			header:    http.Header{"Authorization": {"Bearer forged"}},
+			want:      http.StatusUnauthorized,
+			challenge: `Bearer error="invalid_token"`,
+		},
+		{
+			name:     "user with permission",
+			method:   http.MethodGet,
+			path:     "/mehms",
+			header:   http.Header{"Authorization": {"Bearer user-token"}},
+			want:     http.StatusOK,
+			wantUser: "1",
+		},
+		{
+			name:   "user without permission",
+			method: http.MethodGet,
+			path:   "/users",
+			header: http.Header{"Authorization": {"Bearer user-token"}},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:     "admin",
+			method:   http.MethodGet,
+			path:     "/users",
+			header:   http.Header{"Authorization": {"Bearer admin-token"}},
+			want:     http.StatusOK,
+			wantUser: "2",
+		},
+		{
+			name:     "API key within its scopes",
+			method:   http.MethodGet,
+			path:     "/mehms",
+			header:   http.Header{service.APIKeyHeader: {"read-key"}},
+			want:     http.StatusOK,
+			wantUser: "apikey:k1",
+		},
+		{
+			name:   "API key outside its scopes",
+			method: http.MethodPost,
+			path:   "/mehms",
+			header: http.Header{service.APIKeyHeader: {"read-key"}},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:   "API key scopes beat the user's permissions",
+			method: http.MethodGet,
+			path:   "/users",
+			header: http.Header{service.APIKeyHeader: {"read-key"}, "Authorization": {"Bearer admin-token"}},
+			want:   http.StatusForbidden,
+		},
+		{
+			name:     "admin API key",
+			method:   http.MethodGet,
+			path:     "/users",
+			header:   http.Header{service.APIKeyHeader: {"admin-key"}},
+			want:     http.StatusOK,
+			wantUser: "apikey:k2",
+		},
+		{
+			name:      "unknown API key",
+			method:    http.MethodGet,
+			path:      "/mehms",
+			header:    http.Header{service.APIKeyHeader: {"mk_unknown"}},
+			want:      http.StatusUnauthorized,
+			challenge: `Bearer error="invalid_token"`,
+		},
+	}
+
+	handler := newTestRouter(t, config.BearerAuth).HANDLER()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "http://gateway"+test.path, nil)
+			for name, values := range test.header {
+				for _, value := range values {
+					r.Header.Add(name, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+			if test.wantUser != "" && w.Body.String() != test.wantUser {
+				t.Errorf("user = %q, want %q", w.Body, test.wantUser)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, test.challenge) || (test.challenge == "") != (challenge == "") {
+				t.Errorf("WWW-Authenticate = %q, want prefix %q", challenge, test.challenge)
+			}
+		})
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		method  string
+		cookies map[string]string
+		header  http.Header
+		want    int
+	}{
+		{
+			name:    "cookie without CSRF header",
+			mode:    config.CookieAuth,
+			method:  http.MethodPost,
+			cookies: map[string]string{"jwt": "user-token", "csrf_token": "t0k3n"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "cookie without CSRF cookie",
+			mode:    config.CookieAuth,
+			method:  http.MethodPost,
+			cookies: map[string]string{"jwt": "user-token"},
+			header:  http.Header{"X-Csrf-Token": {"t0k3n"}},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "cookie with mismatching CSRF header",
+			mode:    config.CookieAuth,
+			method:  http.MethodPost,
+			cookies: map[string]string{"jwt": "user-token", "csrf_token": "t0k3n"},
+			header:  http.Header{"X-Csrf-Token": {"other"}},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "cookie with matching CSRF header",
+			mode:    config.CookieAuth,
+			method:  http.MethodPost,
+			cookies: map[string]string{"jwt": "user-token", "csrf_token": "t0k3n"},
+			header:  http.Header{"X-Csrf-Token": {"t0k3n"}},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "safe method with cookie",
+			mode:    config.CookieAuth,
+			method:  http.MethodGet,
+			cookies: map[string]string{"jwt": "user-token"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "bearer token takes precedence over the cookie",
+			mode:    config.MixedAuth,
+			method:  http.MethodPost,
+			cookies: map[string]string{"jwt": "user-token"},
+			header:  http.Header{"Authorization": {"Bearer user-token"}},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "bearer mode ignores cookies",
+			mode:    config.BearerAuth,
+			method:  http.MethodPost,
+			header:  http.Header{"Authorization": {"Bearer user-token"}},
+			cookies: map[string]string{"jwt": "admin-token"},
+			want:    http.StatusOK,
+		},
+		{
+			name:   "API key without cookie",
+			mode:   config.CookieAuth,
+			method: http.MethodPost,
+			header: http.Header{service.APIKeyHeader: {"admin-key"}},
+			want:   http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "http://gateway/mehms", nil)
+			for name, values := range test.header {
+				for _, value := range values {
+					r.Header.Add(name, value)
+				}
+			}
+			for name, value := range test.cookies {
+				r.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			w := httptest.NewRecorder()
+			newTestRouter(t, test.mode).HANDLER().ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+		})
+	}
+}
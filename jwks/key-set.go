@@ -0,0 +1,238 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// minRefetch throttles refreshes triggered by unknown key ids.
+const minRefetch = 10 * time.Second
+
+// errUnsupportedKey marks keys of a type or curve tokens cannot be verified with.
+var errUnsupportedKey = errors.New("unsupported key")
+
+// KeySet resolves the public key a token was signed with.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JSONWebKey is a single entry of a JWKS document as defined by RFC 7517.
+type JSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type Document struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type keySet struct {
+	source  string
+	fetch   func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+	group   singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewFileKeySet reads keys from a JWKS file and rereads it every refresh interval.
+func NewFileKeySet(path string, refresh time.Duration) KeySet {
+	return &keySet{
+		source:  path,
+		refresh: refresh,
+		fetch: func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+}
+
+// NewRemoteKeySet downloads keys from a JWKS endpoint and refetches them every refresh interval.
+func NewRemoteKeySet(url string, refresh time.Duration) KeySet {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return &keySet{
+		source:  url,
+		refresh: refresh,
+		fetch: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+			}
+			return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		},
+	}
+}
+
+// Key returns the key with the given id. Tokens without a kid are accepted if the set holds exactly one key.
+// Keys are fetched without holding the lock, so lookups of known keys never wait for a fetch.
+func (k *keySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	_, known := k.lookup(kid)
+	fetchedAt := k.fetchedAt
+	k.mu.RUnlock()
+
+	if stale := time.Since(fetchedAt) > k.refresh; stale || (!known && time.Since(fetchedAt) > minRefetch) {
+		// one fetch serves all concurrent callers and outlives the one that started it
+		loaded := k.group.DoChan("load", func() (interface{}, error) {
+			return nil, k.load(context.Background())
+		})
+		select {
+		case result := <-loaded:
+			k.mu.RLock()
+			empty := k.keys == nil
+			k.mu.RUnlock()
+			if result.Err != nil && empty {
+				return nil, result.Err
+			}
+		case <-ctx.Done():
+			if !known {
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (k *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// load swaps in freshly fetched keys. On failure the previous keys stay in use.
+func (k *keySet) load(ctx context.Context) error {
+	content, err := k.fetch(ctx)
+	var keys map[string]crypto.PublicKey
+	if err == nil {
+		keys, err = Parse(content)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.fetchedAt = time.Now()
+	if err != nil {
+		return fmt.Errorf("loading keys from %s: %w", k.source, err)
+	}
+	k.keys = keys
+	return nil
+}
+
+// Parse decodes the signing keys of a JWKS document, keyed by their kid. Keys
+// of unsupported types or curves are skipped, so a provider may publish them
+// next to the keys the gateway verifies with.
+func Parse(content []byte) (map[string]crypto.PublicKey, error) {
+	var doc Document
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (j JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, j.Crv)
+		}
+		x, err := decodeInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", j.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("%w: type %q", errUnsupportedKey, j.Kty)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
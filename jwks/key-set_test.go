@@ -0,0 +1,265 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func encode(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaKey(t *testing.T, kid string) (JSONWebKey, *rsa.PublicKey) {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := &private.PublicKey
+	return JSONWebKey{Kid: kid, Kty: "RSA", Use: "sig", N: encode(public.N), E: encode(big.NewInt(int64(public.E)))}, public
+}
+
+func ecKey(t *testing.T, kid string) (JSONWebKey, *ecdsa.PublicKey) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := &private.PublicKey
+	return JSONWebKey{Kid: kid, Kty: "EC", Crv: "P-256", X: encode(public.X), Y: encode(public.Y)}, public
+}
+
+func document(t *testing.T, keys ...JSONWebKey) []byte {
+	t.Helper()
+	content, err := json.Marshal(Document{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestParse(t *testing.T) {
+	rsaJWK, rsaPublic := rsaKey(t, "rsa")
+	ecJWK, ecPublic := ecKey(t, "ec")
+
+	encryption := rsaJWK
+	encryption.Kid, encryption.Use = "enc", "enc"
+	okp := JSONWebKey{Kid: "okp", Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	secp := ecJWK
+	secp.Kid, secp.Crv = "secp", "secp256k1"
+	offCurve := ecJWK
+	offCurve.Y = encode(big.NewInt(1))
+	smallExponent := rsaJWK
+	smallExponent.E = encode(big.NewInt(1))
+	badBase64 := rsaJWK
+	badBase64.N = "not base64!"
+
+	tests := []struct {
+		name    string
+		keys    []JSONWebKey
+		want    map[string]crypto.PublicKey
+		wantErr string
+	}{
+		{name: "RSA and EC", keys: []JSONWebKey{rsaJWK, ecJWK}, want: map[string]crypto.PublicKey{"rsa": rsaPublic, "ec": ecPublic}},
+		{name: "encryption keys are skipped", keys: []JSONWebKey{rsaJWK, encryption}, want: map[string]crypto.PublicKey{"rsa": rsaPublic}},
+		{name: "unsupported types and curves are skipped", keys: []JSONWebKey{okp, secp, ecJWK}, want: map[string]crypto.PublicKey{"ec": ecPublic}},
+		{name: "point off the curve", keys: []JSONWebKey{offCurve}, wantErr: "not on curve"},
+		{name: "small exponent", keys: []JSONWebKey{smallExponent}, wantErr: "invalid RSA exponent"},
+		{name: "broken encoding", keys: []JSONWebKey{badBase64}, wantErr: "illegal base64"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := Parse(document(t, test.keys...))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != len(test.want) {
+				t.Fatalf("Parse() = %v, want %d keys", keys, len(test.want))
+			}
+			for kid, want := range test.want {
+				if key, ok := keys[kid].(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(want) {
+					t.Errorf("key %s = %v, want %v", kid, keys[kid], want)
+				}
+			}
+		})
+	}
+}
+
+// fakeSource serves a JWKS document that can be swapped and counts the fetches.
+type fakeSource struct {
+	mu      sync.Mutex
+	content []byte
+	err     error
+	fetches int
+}
+
+func (s *fakeSource) fetch(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	return s.content, s.err
+}
+
+func (s *fakeSource) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func TestKeySelection(t *testing.T) {
+	first, firstPublic := ecKey(t, "first")
+	second, secondPublic := ecKey(t, "second")
+
+	tests := []struct {
+		name    string
+		keys    []JSONWebKey
+		kid     string
+		want    crypto.PublicKey
+		wantErr string
+	}{
+		{name: "by kid", keys: []JSONWebKey{first, second}, kid: "second", want: secondPublic},
+		{name: "without kid from a single key", keys: []JSONWebKey{first}, want: firstPublic},
+		{name: "without kid from several keys", keys: []JSONWebKey{first, second}, wantErr: `unknown signing key ""`},
+		{name: "unknown kid", keys: []JSONWebKey{first}, kid: "third", wantErr: `unknown signing key "third"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := &fakeSource{content: document(t, test.keys...)}
+			set := &keySet{source: "fake", fetch: source.fetch, refresh: time.Hour}
+
+			key, err := set.Key(context.Background(), test.kid)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("Key() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.(*ecdsa.PublicKey).Equal(test.want) {
+				t.Errorf("Key() = %v, want %v", key, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	first, _ := ecKey(t, "first")
+	second, _ := ecKey(t, "second")
+	source := &fakeSource{content: document(t, first)}
+	set := &keySet{source: "fake", fetch: source.fetch, refresh: time.Hour}
+
+	if _, err := set.Key(context.Background(), "first"); err != nil {
+		t.Fatal(err)
+	}
+	source.mu.Lock()
+	source.content = document(t, second)
+	source.mu.Unlock()
+
+	// unknown keys are refetched at most every minRefetch
+	if _, err := set.Key(context.Background(), "second"); err == nil {
+		t.Errorf("rotated key was refetched right away")
+	}
+	set.mu.Lock()
+	set.fetchedAt = time.Now().Add(-minRefetch - time.Second)
+	set.mu.Unlock()
+	if _, err := set.Key(context.Background(), "second"); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+	if source.count() != 2 {
+		t.Errorf("keys were fetched %d times, want 2", source.count())
+	}
+
+	// a failed refresh keeps the keys in use
+	source.mu.Lock()
+	source.err = errors.New("unavailable")
+	source.mu.Unlock()
+	set.mu.Lock()
+	set.fetchedAt = time.Now().Add(-2 * time.Hour)
+	set.mu.Unlock()
+	if _, err := set.Key(context.Background(), "second"); err != nil {
+		t.Errorf("failed refresh dropped the keys: %v", err)
+	}
+}
+
+func TestKeyFailsWithoutKeys(t *testing.T) {
+	source := &fakeSource{err: errors.New("unavailable")}
+	set := &keySet{source: "fake", fetch: source.fetch, refresh: time.Hour}
+
+	if _, err := set.Key(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Errorf("Key() error = %v, want the fetch error", err)
+	}
+}
+
+func TestKeyFetchesOnceForConcurrentCallers(t *testing.T) {
+	jwk, _ := ecKey(t, "only")
+	release := make(chan struct{})
+	source := &fakeSource{content: document(t, jwk)}
+	set := &keySet{source: "fake", refresh: time.Hour, fetch: func(ctx context.Context) ([]byte, error) {
+		<-release
+		return source.fetch(ctx)
+	}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := set.Key(context.Background(), "only")
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.count() != 1 {
+		t.Errorf("keys were fetched %d times, want 1", source.count())
+	}
+}
+
+func TestFileKeySet(t *testing.T) {
+	jwk, public := rsaKey(t, "file")
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, document(t, jwk), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewFileKeySet(file, time.Hour).Key(context.Background(), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.(*rsa.PublicKey).Equal(public) {
+		t.Errorf("Key() = %v, want %v", key, public)
+	}
+}
@@ -0,0 +1,112 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Manager owns the gateway's http servers and shuts them down gracefully.
+type Manager interface {
+	Register(name string, server *http.Server)
+	Ready() bool
+	Run() error
+}
+
+type Options struct {
+	// ShutdownTimeout bounds how long in-flight requests may take to drain.
+	ShutdownTimeout time.Duration
+	// ReadinessDelay is the time between failing readiness and closing the
+	// listeners, so load balancers stop routing before connections are refused.
+	ReadinessDelay time.Duration
+}
+
+type namedServer struct {
+	name   string
+	server *http.Server
+}
+
+type manager struct {
+	opts     Options
+	servers  []namedServer
+	draining int32
+}
+
+func NewManager(opts Options) Manager {
+	return &manager{opts: opts}
+}
+
+func (m *manager) Register(name string, server *http.Server) {
+	m.servers = append(m.servers, namedServer{name: name, server: server})
+}
+
+func (m *manager) Ready() bool {
+	return atomic.LoadInt32(&m.draining) == 0
+}
+
+// Run serves all registered servers until SIGINT or SIGTERM is received or
+// one of them fails, then drains all of them.
+func (m *manager) Run() error {
+	failed := make(chan error, len(m.servers))
+	for _, s := range m.servers {
+		go func(s namedServer) {
+			log.Printf("%s server listening on %s", s.name, s.server.Addr)
+			if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}(s)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var cause error
+	select {
+	case sig := <-signals:
+		log.Printf("received %s, shutting down", sig)
+	case cause = <-failed:
+		log.Printf("server failed, shutting down: %v", cause)
+	}
+
+	if err := m.shutdown(cause == nil); err != nil && cause == nil {
+		cause = err
+	}
+	return cause
+}
+
+func (m *manager) shutdown(delay bool) error {
+	atomic.StoreInt32(&m.draining, 1)
+	if delay {
+		time.Sleep(m.opts.ReadinessDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.servers))
+	for _, s := range m.servers {
+		wg.Add(1)
+		go func(s namedServer) {
+			defer wg.Done()
+			if err := s.server.Shutdown(ctx); err != nil {
+				log.Printf("%s server did not drain in time: %v", s.name, err)
+				errs <- err
+				return
+			}
+			log.Printf("%s server drained", s.name)
+		}(s)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/batch"
+	"github.com/nillga/mehm-services-api-gateway/config"
 	"github.com/nillga/mehm-services-api-gateway/controller"
 	_ "github.com/nillga/mehm-services-api-gateway/docs"
+	"github.com/nillga/mehm-services-api-gateway/dto"
+	"github.com/nillga/mehm-services-api-gateway/health"
 	router "github.com/nillga/mehm-services-api-gateway/http"
+	"github.com/nillga/mehm-services-api-gateway/jwks"
+	"github.com/nillga/mehm-services-api-gateway/lifecycle"
+	"github.com/nillga/mehm-services-api-gateway/media"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/revocation"
+	"github.com/nillga/mehm-services-api-gateway/service"
+	"github.com/nillga/mehm-services-api-gateway/upstream"
 	"github.com/rs/cors"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-var apiController = controller.NewApiGatewayController()
-var apiRouter = router.NewApiGatewayRouter()
-
 // @title           Swagger Example API
 // @version         1.0
 // @description     This is a sample server celler server.
@@ -35,26 +46,93 @@ var apiRouter = router.NewApiGatewayRouter()
 // @in header
 // @name Authorization
 
+// @securityDefinitions.apikey apiKey
+// @in header
+// @name X-API-Key
+
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	genres, err := dto.NewGenreRegistry(cfg.Genres)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	accessPolicy, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	revoked, err := newRevocationStore(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	apiKeys, err := apikey.NewFileStore(cfg.APIKeysFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	images, err := media.NewDirStore(cfg.Upload.ImageDir, cfg.Upload.ImageURL)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	apiService := service.NewApiGatewayService(cfg, newKeySet(cfg), revoked, apiKeys)
+	users := newUpstream(cfg, "users", cfg.UsersHost)
+	mehms := newUpstream(cfg, "mehms", cfg.MehmsHost)
+	apiController := controller.NewApiGatewayController(cfg, apiService, accessPolicy, genres, users, mehms, apiKeys, images)
+	apiRouter := router.NewApiGatewayRouter(cfg, apiService, accessPolicy)
+	batches := batch.NewExecutor(apiRouter.HANDLER(), cfg.BatchOptions())
+	manager := lifecycle.NewManager(lifecycle.Options{
+		ShutdownTimeout: cfg.Lifecycle.ShutdownTimeout.Duration(),
+		ReadinessDelay:  cfg.Lifecycle.ReadinessDelay.Duration(),
+	})
+	checker := health.NewChecker(manager.Ready, health.Options{
+		Timeout:  cfg.Health.Timeout.Duration(),
+		CacheTTL: cfg.Health.CacheTTL.Duration(),
+	}, dependency(cfg, "users", cfg.UsersHost), dependency(cfg, "mehms", cfg.MehmsHost))
+
 	cr := chi.NewRouter()
 
 	cr.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:1323/swagger/doc.json"), //The url pointing to API definition
 	))
 
-	apiRouter.GET("/api/mehms", apiController.GetAllMehms)
-	apiRouter.GET("/api/mehms/{id}", apiController.GetSpecificMehm)
-	apiRouter.POST("/api/mehms/{id}/like", apiController.LikeMehm)
-	apiRouter.POST("/api/mehms/{id}/remove", apiController.DeleteMehm)
-	apiRouter.GET("/api/user", apiController.ResolveProfile)
-	apiRouter.GET("/api/user/all", apiController.AllUsers)
-	apiRouter.POST("/api/user/elevate", apiController.ToggleElevation)
-	apiRouter.POST("/api/user/delete", apiController.DeleteUser)
-	apiRouter.GET("/api/comments/{id}", apiController.GetComment)
-	apiRouter.POST("/api/comments/new", apiController.PostComment)
-	apiRouter.POST("/api/comments/update", apiController.EditComment)
-	apiRouter.POST("/api/comments/remove", apiController.DeleteComment)
-	apiRouter.POST("/api/mehms/{id}/update", apiController.EditMehm)
+	apiRouter.POST("/api/auth/login", policy.Public, apiController.Login)
+	apiRouter.POST("/api/auth/signup", policy.Public, apiController.Signup)
+	apiRouter.POST("/api/auth/refresh", policy.Public, apiController.Refresh)
+	apiRouter.POST("/api/auth/logout", policy.Public, apiController.Logout)
+	apiRouter.GET("/api/auth/csrf", policy.Public, apiController.CSRFToken)
+	apiRouter.GET("/api/genres", policy.Public, apiController.Genres)
+	apiRouter.GET("/api/mehms", policy.ReadMehms, apiController.GetAllMehms)
+	apiRouter.POST("/api/mehms/new", policy.PostMehms, apiController.CreateMehm)
+	apiRouter.GET("/api/images/{id}/{file}", policy.Public, apiController.Image)
+	apiRouter.GET("/api/mehms/{id}", policy.ReadMehms, apiController.GetSpecificMehm)
+	apiRouter.GET("/api/mehms/{id}/full", policy.ReadMehms, apiController.GetMehmDetail)
+	apiRouter.GET("/api/mehms/{id}/comments", policy.ReadMehms, apiController.GetMehmComments)
+	apiRouter.POST("/api/mehms/{id}/like", policy.LikeMehms, apiController.LikeMehm)
+	apiRouter.POST("/api/mehms/{id}/remove", policy.DeleteMehms, apiController.DeleteMehm)
+	apiRouter.GET("/api/user", policy.ReadProfile, apiController.ResolveProfile)
+	apiRouter.GET("/api/user/all", policy.ListUsers, apiController.AllUsers)
+	apiRouter.POST("/api/user/elevate", policy.ElevateUsers, apiController.ToggleElevation)
+	apiRouter.POST("/api/user/delete", policy.DeleteUsers, apiController.DeleteUser)
+	apiRouter.GET("/api/comments/{id}", policy.ReadComments, apiController.GetComment)
+	apiRouter.POST("/api/comments/new", policy.PostComments, apiController.PostComment)
+	apiRouter.POST("/api/comments/update", policy.EditComments, apiController.EditComment)
+	apiRouter.POST("/api/comments/remove", policy.DeleteComments, apiController.DeleteComment)
+	apiRouter.POST("/api/mehms/{id}/update", policy.EditMehms, apiController.EditMehm)
+	apiRouter.GET("/api/admin/upstreams", policy.ViewUpstreams, apiController.UpstreamStatus)
+	apiRouter.GET("/api/admin/apikeys", policy.ManageAPIKeys, apiController.ListAPIKeys)
+	apiRouter.POST("/api/admin/apikeys", policy.ManageAPIKeys, apiController.CreateAPIKey)
+	apiRouter.POST("/api/admin/apikeys/{id}/revoke", policy.ManageAPIKeys, apiController.RevokeAPIKey)
+	apiRouter.POST("/api/graphql", policy.Public, apiController.GraphQL)
+	apiRouter.POST("/api/batch", policy.Public, batches.Batch)
+	apiRouter.GET("/healthz", policy.Public, checker.Liveness)
+	apiRouter.GET("/readyz", policy.Public, checker.Readiness)
 
 	c := cors.New(cors.Options{
 		AllowedHeaders: []string{"Authorization", "Credentials", "Cookie"},
@@ -63,8 +141,58 @@ func main() {
 	l.SetOutput(os.Stdout)
 	c.Log = &l
 
-	go func() {
-		log.Fatalln(http.ListenAndServe(os.Getenv("SWAG"), c.Handler(cr)))
-	}()
-	apiRouter.SERVE(os.Getenv("PORT"))
+	if cfg.Swagger != "" {
+		manager.Register("swagger", &http.Server{
+			Addr:              cfg.Swagger,
+			Handler:           c.Handler(cr),
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+	manager.Register("api", &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           apiRouter.HANDLER(),
+		ReadHeaderTimeout: 10 * time.Second,
+	})
+
+	if err := manager.Run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func newKeySet(cfg *config.Config) jwks.KeySet {
+	switch {
+	case cfg.JWT.JWKSURL != "":
+		return jwks.NewRemoteKeySet(cfg.JWT.JWKSURL, cfg.JWT.JWKSRefresh.Duration())
+	case cfg.JWT.JWKSFile != "":
+		return jwks.NewFileKeySet(cfg.JWT.JWKSFile, cfg.JWT.JWKSRefresh.Duration())
+	}
+	return nil
+}
+
+func newRevocationStore(cfg *config.Config) (revocation.Store, error) {
+	backend := revocation.NewMemoryBackend()
+	if cfg.Revocation.File != "" {
+		var err error
+		if backend, err = revocation.NewFileBackend(cfg.Revocation.File); err != nil {
+			return nil, err
+		}
+	}
+	return revocation.NewStore(backend, cfg.Revocation.TokenLifetime.Duration()), nil
+}
+
+// newUpstream guards an upstream with its own retry budget and circuit breaker.
+func newUpstream(cfg *config.Config, name, baseURL string) upstream.Breaker {
+	client := upstream.NewClient(name, baseURL, cfg.ClientOptions())
+	return upstream.NewBreaker(upstream.NewRetrier(client, cfg.RetryOptions()), cfg.BreakerOptions())
+}
+
+// dependency probes an upstream with its own client so readiness is unaffected by circuit breakers and retries.
+func dependency(cfg *config.Config, name, baseURL string) health.Dependency {
+	client := upstream.NewClient(name, baseURL, cfg.ClientOptions())
+	return health.Dependency{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			return upstream.Ping(ctx, client, "/")
+		},
+	}
 }
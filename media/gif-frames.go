@@ -0,0 +1,58 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errTruncatedGIF = errors.New("gif: truncated")
+
+// gifFrames counts the frames of a GIF by walking its blocks, without
+// decompressing any pixels.
+func gifFrames(data []byte) (int, error) {
+	const header = 13
+	if len(data) < header {
+		return 0, errTruncatedGIF
+	}
+	pos := header
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	frames := 0
+	for {
+		if pos >= len(data) {
+			return 0, errTruncatedGIF
+		}
+		switch data[pos] {
+		case 0x21: // extension: label and sub-blocks
+			pos += 2
+		case 0x2C: // image descriptor, optional local color table, LZW code size and sub-blocks
+			if pos+10 > len(data) {
+				return 0, errTruncatedGIF
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("gif: unknown block type 0x%02x", data[pos])
+		}
+
+		for {
+			if pos >= len(data) {
+				return 0, errTruncatedGIF
+			}
+			size := int(data[pos])
+			pos += size + 1
+			if size == 0 {
+				break
+			}
+		}
+	}
+}
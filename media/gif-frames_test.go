@@ -0,0 +1,76 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// animation encodes a GIF of frames with the given size. Odd frames get their
+// own palette, so they carry a local color table.
+func animation(t *testing.T, frames, width, height int) []byte {
+	t.Helper()
+	global := color.Palette{color.Black, color.White}
+	local := color.Palette{color.White, color.Black, color.Transparent}
+	g := &gif.GIF{Config: image.Config{ColorModel: global, Width: width, Height: height}}
+	for i := 0; i < frames; i++ {
+		palette := global
+		if i%2 == 1 {
+			palette = local
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		frame.SetColorIndex(i%width, 0, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	three := animation(t, 3, 4, 4)
+	// a global color table of two entries and a comment extension in front of the frame
+	withComment := append([]byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff"+
+		"\x21\xfe\x05hello\x00"),
+		"\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x44\x01\x00\x3b"...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr string
+	}{
+		{name: "single frame", data: animation(t, 1, 4, 4), want: 1},
+		{name: "frames with local color tables", data: three, want: 3},
+		{name: "extensions are skipped", data: withComment, want: 1},
+		{name: "no frames", data: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x3b"), want: 0},
+		{name: "shorter than the header", data: []byte("GIF89a"), wantErr: errTruncatedGIF.Error()},
+		{name: "without trailer", data: three[:len(three)-1], wantErr: errTruncatedGIF.Error()},
+		{name: "cut in a frame", data: three[:len(three)/2], wantErr: errTruncatedGIF.Error()},
+		{name: "cut in the color table", data: withComment[:15], wantErr: errTruncatedGIF.Error()},
+		{name: "unknown block", data: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x42"), wantErr: "gif: unknown block type 0x42"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames, err := gifFrames(test.data)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("gifFrames() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frames != test.want {
+				t.Errorf("gifFrames() = %d, want %d", frames, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Original names the re-encoded full size image among the variants.
+const Original = "original"
+
+var ErrTooManyPixels = errors.New("image exceeds the maximum dimensions")
+
+type Options struct {
+	MaxWidth  int
+	MaxHeight int
+	// MaxAnimationPixels bounds width times height times frames of an
+	// animated image, which are all decoded at once.
+	MaxAnimationPixels int
+	// ThumbnailWidths are scaled down to, keeping the aspect ratio. Widths
+	// at or above the width of the image are skipped.
+	ThumbnailWidths []int
+	JPEGQuality     int
+}
+
+// Variant is an encoded version of an uploaded image.
+type Variant struct {
+	Name     string
+	MimeType string
+	Width    int
+	Height   int
+	Data     []byte
+}
+
+func (v Variant) FileName() string {
+	return v.Name + Extension(v.MimeType)
+}
+
+// Process decodes an image and encodes it again, which drops all metadata like
+// EXIF, comments or trailing data. The dimensions, and the frames of a GIF, are
+// checked from the headers before the pixels are decoded. The original variant comes first.
+func Process(data []byte, opts Options) ([]Variant, error) {
+	mimeType, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := decodeConfig(mimeType, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > opts.MaxWidth || cfg.Height > opts.MaxHeight {
+		return nil, fmt.Errorf("%w of %dx%d pixels", ErrTooManyPixels, opts.MaxWidth, opts.MaxHeight)
+	}
+	if mimeType == GIF {
+		frames, err := gifFrames(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if frames < 1 {
+			return nil, fmt.Errorf("%w: gif has no frames", ErrUnsupportedType)
+		}
+		if int64(cfg.Width)*int64(cfg.Height)*int64(frames) > int64(opts.MaxAnimationPixels) {
+			return nil, fmt.Errorf("%w: %d frames of %dx%d pixels exceed %d pixels in total", ErrTooManyPixels, frames, cfg.Width, cfg.Height, opts.MaxAnimationPixels)
+		}
+	}
+
+	original, img, err := reencode(mimeType, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	variants := []Variant{original}
+
+	widths := append([]int(nil), opts.ThumbnailWidths...)
+	sort.Ints(widths)
+	bounds := img.Bounds()
+	for _, width := range widths {
+		if width < 1 || width >= bounds.Dx() {
+			continue
+		}
+		height := bounds.Dy() * width / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+		thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+
+		variant, err := encode(fmt.Sprintf("w%d", width), thumbnailType(original.MimeType), thumbnail, opts)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+func decodeConfig(mimeType string, data []byte) (image.Config, error) {
+	r := bytes.NewReader(data)
+	switch mimeType {
+	case PNG:
+		return png.DecodeConfig(r)
+	case JPEG:
+		return jpeg.DecodeConfig(r)
+	case GIF:
+		return gif.DecodeConfig(r)
+	case WebP:
+		return webp.DecodeConfig(r)
+	}
+	return image.Config{}, ErrUnsupportedType
+}
+
+// reencode keeps JPEG photos lossy and animated GIFs animated, everything else
+// becomes a PNG. It returns the image thumbnails are made from.
+func reencode(mimeType string, data []byte, opts Options) (Variant, image.Image, error) {
+	r := bytes.NewReader(data)
+	switch mimeType {
+	case GIF:
+		animation, err := gif.DecodeAll(r)
+		if err != nil {
+			return Variant{}, nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		if len(animation.Image) > 1 {
+			var buf bytes.Buffer
+			if err = gif.EncodeAll(&buf, animation); err != nil {
+				return Variant{}, nil, err
+			}
+			return Variant{
+				Name:     Original,
+				MimeType: GIF,
+				Width:    animation.Config.Width,
+				Height:   animation.Config.Height,
+				Data:     buf.Bytes(),
+			}, animation.Image[0], nil
+		}
+		variant, err := encode(Original, PNG, animation.Image[0], opts)
+		return variant, animation.Image[0], err
+	case JPEG:
+		img, err := jpeg.Decode(r)
+		if err != nil {
+			return Variant{}, nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		variant, err := encode(Original, JPEG, img, opts)
+		return variant, img, err
+	case PNG, WebP:
+		var img image.Image
+		var err error
+		if mimeType == PNG {
+			img, err = png.Decode(r)
+		} else {
+			img, err = webp.Decode(r)
+		}
+		if err != nil {
+			return Variant{}, nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+		}
+		variant, err := encode(Original, PNG, img, opts)
+		return variant, img, err
+	}
+	return Variant{}, nil, ErrUnsupportedType
+}
+
+// thumbnailType picks a still image format for thumbnails.
+func thumbnailType(mimeType string) string {
+	if mimeType == JPEG {
+		return JPEG
+	}
+	return PNG
+}
+
+func encode(name, mimeType string, img image.Image, opts Options) (Variant, error) {
+	var buf bytes.Buffer
+	var err error
+	if mimeType == JPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.JPEGQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Variant{}, err
+	}
+
+	bounds := img.Bounds()
+	return Variant{
+		Name:     name,
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Data:     buf.Bytes(),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func picture(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	opts := Options{MaxWidth: 100, MaxHeight: 100, MaxAnimationPixels: 4 * 4 * 3, ThumbnailWidths: []int{40, 10, 80}, JPEGQuality: 80}
+	photo := encodePNG(t, picture(60, 30))
+
+	type variant struct {
+		Name     string
+		MimeType string
+		Width    int
+		Height   int
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    Options
+		want    []variant
+		wantErr error
+	}{
+		{
+			name: "PNG with thumbnails below its width",
+			data: photo,
+			opts: opts,
+			want: []variant{{Original, PNG, 60, 30}, {"w10", PNG, 10, 5}, {"w40", PNG, 40, 20}},
+		},
+		{
+			name: "JPEG stays lossy",
+			data: encodeJPEG(t, picture(60, 30)),
+			opts: opts,
+			want: []variant{{Original, JPEG, 60, 30}, {"w10", JPEG, 10, 5}, {"w40", JPEG, 40, 20}},
+		},
+		{
+			name: "trailing data is dropped",
+			data: append(append([]byte(nil), photo...), "<?php system($_GET['c']); ?>"...),
+			opts: opts,
+			want: []variant{{Original, PNG, 60, 30}, {"w10", PNG, 10, 5}, {"w40", PNG, 40, 20}},
+		},
+		{
+			name: "thumbnails keep at least one pixel",
+			data: encodePNG(t, picture(60, 2)),
+			opts: Options{MaxWidth: 100, MaxHeight: 100, ThumbnailWidths: []int{10}},
+			want: []variant{{Original, PNG, 60, 2}, {"w10", PNG, 10, 1}},
+		},
+		{
+			name: "animated GIF stays animated",
+			data: animation(t, 3, 4, 4),
+			opts: Options{MaxWidth: 100, MaxHeight: 100, MaxAnimationPixels: 48, ThumbnailWidths: []int{2}},
+			want: []variant{{Original, GIF, 4, 4}, {"w2", PNG, 2, 2}},
+		},
+		{
+			name: "still GIF becomes a PNG",
+			data: animation(t, 1, 4, 4),
+			opts: Options{MaxWidth: 100, MaxHeight: 100, MaxAnimationPixels: 16},
+			want: []variant{{Original, PNG, 4, 4}},
+		},
+		{name: "too wide", data: photo, opts: Options{MaxWidth: 59, MaxHeight: 100}, wantErr: ErrTooManyPixels},
+		{name: "too high", data: photo, opts: Options{MaxWidth: 100, MaxHeight: 29}, wantErr: ErrTooManyPixels},
+		{name: "too many frames", data: animation(t, 4, 4, 4), opts: opts, wantErr: ErrTooManyPixels},
+		{name: "GIF without frames", data: []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x3b"), opts: opts, wantErr: ErrUnsupportedType},
+		{name: "broken GIF", data: animation(t, 2, 4, 4)[:40], opts: opts, wantErr: ErrUnsupportedType},
+		{name: "broken PNG", data: photo[:len(photo)/2], opts: opts, wantErr: ErrUnsupportedType},
+		{name: "no image", data: []byte("%PDF-1.7"), opts: opts, wantErr: ErrUnsupportedType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			variants, err := Process(test.data, test.opts)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Process() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []variant
+			for _, v := range variants {
+				got = append(got, variant{v.Name, v.MimeType, v.Width, v.Height})
+
+				mimeType, err := Detect(v.Data)
+				if err != nil || mimeType != v.MimeType {
+					t.Errorf("%s is encoded as %s, want %s", v.Name, mimeType, v.MimeType)
+				}
+				cfg, err := decodeConfig(v.MimeType, v.Data)
+				if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+					t.Errorf("%s is %dx%d, want %dx%d", v.Name, cfg.Width, cfg.Height, v.Width, v.Height)
+				}
+				if bytes.Contains(v.Data, []byte("<?php")) {
+					t.Errorf("%s kept the trailing data", v.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Process() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessKeepsFrames(t *testing.T) {
+	variants, err := Process(animation(t, 3, 4, 4), Options{MaxWidth: 4, MaxHeight: 4, MaxAnimationPixels: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := gifFrames(variants[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != 3 {
+		t.Errorf("re-encoded GIF has %d frames, want 3", frames)
+	}
+}
@@ -0,0 +1,79 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// MIME types of the accepted image formats.
+const (
+	PNG  = "image/png"
+	JPEG = "image/jpeg"
+	GIF  = "image/gif"
+	WebP = "image/webp"
+)
+
+// SniffLength bytes of an image suffice to detect its format.
+const SniffLength = 12
+
+var (
+	ErrUnsupportedType = errors.New("image must be a PNG, JPEG, GIF or WebP")
+	ErrTooLarge        = errors.New("image exceeds the maximum upload size")
+)
+
+// Detect tells the format of an image by its magic bytes. The client's
+// declared content type is never trusted.
+func Detect(head []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return JPEG, nil
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return GIF, nil
+	case len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")):
+		return WebP, nil
+	}
+	return "", ErrUnsupportedType
+}
+
+// Extension returns the file extension matching a detected MIME type.
+func Extension(mimeType string) string {
+	switch mimeType {
+	case PNG:
+		return ".png"
+	case JPEG:
+		return ".jpg"
+	case GIF:
+		return ".gif"
+	case WebP:
+		return ".webp"
+	}
+	return ""
+}
+
+// LimitReader fails with ErrTooLarge once more than max bytes are read from r.
+func LimitReader(r io.Reader, max int64) io.Reader {
+	return &limitReader{r: r, left: max}
+}
+
+type limitReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
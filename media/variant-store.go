@@ -0,0 +1,100 @@
+package media
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps the variants of each mehm's image and tells their URLs.
+type Store interface {
+	Save(mehmId string, variants []Variant) error
+	// URLs maps the variant names of a mehm to their URLs. It is empty for
+	// mehms uploaded before images were processed by the gateway.
+	URLs(mehmId string) (map[string]string, error)
+	Open(mehmId, file string) (io.ReadSeekCloser, error)
+}
+
+type dirStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewDirStore saves variants as <dir>/<mehm id>/<variant>.<ext>, served below baseURL.
+func NewDirStore(dir, baseURL string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating image directory: %w", err)
+	}
+	return &dirStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *dirStore) Save(mehmId string, variants []Variant) error {
+	dir, err := s.path(mehmId)
+	if err != nil {
+		return err
+	}
+	// variants of an earlier image must not be listed next to the new ones
+	if err = os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, variant := range variants {
+		tmp := filepath.Join(dir, variant.FileName()+".tmp")
+		if err = os.WriteFile(tmp, variant.Data, 0644); err != nil {
+			return err
+		}
+		if err = os.Rename(tmp, filepath.Join(dir, variant.FileName())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *dirStore) URLs(mehmId string) (map[string]string, error) {
+	dir, err := s.path(mehmId)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || ext == ".tmp" {
+			continue
+		}
+		urls[strings.TrimSuffix(name, ext)] = s.baseURL + "/" + mehmId + "/" + name
+	}
+	return urls, nil
+}
+
+func (s *dirStore) Open(mehmId, file string) (io.ReadSeekCloser, error) {
+	dir, err := s.path(mehmId)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" || file != filepath.Base(file) || strings.HasPrefix(file, ".") {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(dir, file))
+}
+
+// path rejects ids that could escape the image directory.
+func (s *dirStore) path(mehmId string) (string, error) {
+	if mehmId == "" || mehmId != filepath.Base(mehmId) || strings.HasPrefix(mehmId, ".") {
+		return "", fmt.Errorf("invalid mehm id %q", mehmId)
+	}
+	return filepath.Join(s.dir, mehmId), nil
+}
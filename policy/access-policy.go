@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nillga/jwt-server/entity"
+	"gopkg.in/yaml.v2"
+)
+
+// Permission names an action a route performs.
+type Permission string
+
+const (
+	// Public routes are served without authentication.
+	Public Permission = ""
+
+	ReadMehms      Permission = "mehms:read"
+	PostMehms      Permission = "mehms:post"
+	LikeMehms      Permission = "mehms:like"
+	EditMehms      Permission = "mehms:edit"
+	DeleteMehms    Permission = "mehms:delete"
+	ReadComments   Permission = "comments:read"
+	PostComments   Permission = "comments:post"
+	EditComments   Permission = "comments:edit"
+	DeleteComments Permission = "comments:delete"
+	ReadProfile    Permission = "profile:read"
+	ListUsers      Permission = "users:list"
+	ElevateUsers   Permission = "users:elevate"
+	DeleteUsers    Permission = "users:delete"
+	ViewUpstreams  Permission = "admin:upstreams"
+	ManageAPIKeys  Permission = "admin:apikeys"
+)
+
+// Scope tells whether a permission applies to the caller's own resources or to all of them.
+type Scope uint8
+
+const (
+	None Scope = iota
+	Own
+	Any
+)
+
+const (
+	// UserRole is held by every authenticated user.
+	UserRole = "user"
+	// AdminRole is held by users carrying the admin flag.
+	AdminRole = "admin"
+
+	wildcard  = "*"
+	ownSuffix = ":own"
+)
+
+type Policy interface {
+	Roles(user *entity.User) []string
+	Scope(user *entity.User, permission Permission) Scope
+}
+
+// Role grants permissions. A grant ending in ":own" is limited to the
+// caller's own resources, "*" grants everything.
+type Role struct {
+	Inherits    []string `json:"inherits" yaml:"inherits"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+}
+
+// Document is the file format of a policy.
+type Document struct {
+	Roles map[string]Role `json:"roles" yaml:"roles"`
+	// Subjects assigns additional roles to user ids.
+	Subjects map[string][]string `json:"subjects" yaml:"subjects"`
+}
+
+type policy struct {
+	grants   map[string]map[Permission]Scope
+	subjects map[string][]string
+}
+
+// DefaultDocument mirrors the gateway's built-in rules: users act on their own
+// content, admins on everything.
+func DefaultDocument() Document {
+	return Document{
+		Roles: map[string]Role{
+			UserRole: {Permissions: []string{
+				string(ReadMehms),
+				string(PostMehms),
+				string(LikeMehms),
+				string(EditMehms) + ownSuffix,
+				string(DeleteMehms) + ownSuffix,
+				string(ReadComments),
+				string(PostComments),
+				string(EditComments) + ownSuffix,
+				string(DeleteComments) + ownSuffix,
+				string(ReadProfile),
+				string(DeleteUsers) + ownSuffix,
+			}},
+			AdminRole: {Permissions: []string{wildcard}},
+		},
+	}
+}
+
+// Load reads a policy document from a YAML or JSON file. Without a file the default document is used.
+func Load(file string) (Policy, error) {
+	if file == "" {
+		return New(DefaultDocument())
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	var doc Document
+	if err = yaml.UnmarshalStrict(content, &doc); err != nil {
+		return nil, fmt.Errorf("parsing policy file %s: %w", file, err)
+	}
+	return New(doc)
+}
+
+func New(doc Document) (Policy, error) {
+	p := &policy{
+		grants:   make(map[string]map[Permission]Scope, len(doc.Roles)),
+		subjects: doc.Subjects,
+	}
+
+	for name := range doc.Roles {
+		grants, err := resolve(doc, name, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		p.grants[name] = grants
+	}
+	for subject, roles := range doc.Subjects {
+		for _, role := range roles {
+			if _, ok := doc.Roles[role]; !ok {
+				return nil, fmt.Errorf("subject %s has unknown role %s", subject, role)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func (p *policy) Roles(user *entity.User) []string {
+	if user == nil {
+		return nil
+	}
+
+	roles := []string{UserRole}
+	if user.Admin {
+		roles = append(roles, AdminRole)
+	}
+	roles = append(roles, p.subjects[user.Id]...)
+	sort.Strings(roles)
+
+	return roles
+}
+
+func (p *policy) Scope(user *entity.User, permission Permission) Scope {
+	scope := None
+	for _, role := range p.Roles(user) {
+		grants := p.grants[role]
+		if grants[wildcard] > scope {
+			scope = grants[wildcard]
+		}
+		if grants[permission] > scope {
+			scope = grants[permission]
+		}
+	}
+	return scope
+}
+
+func resolve(doc Document, name string, visiting map[string]bool) (map[Permission]Scope, error) {
+	role, ok := doc.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown role %s", name)
+	}
+	if visiting[name] {
+		return nil, fmt.Errorf("role %s inherits from itself", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	grants := map[Permission]Scope{}
+	for _, parent := range role.Inherits {
+		inherited, err := resolve(doc, parent, visiting)
+		if err != nil {
+			return nil, err
+		}
+		merge(grants, inherited)
+	}
+
+	for _, grant := range role.Permissions {
+		permission, scope := Permission(grant), Any
+		if strings.HasSuffix(grant, ownSuffix) {
+			permission, scope = Permission(strings.TrimSuffix(grant, ownSuffix)), Own
+		}
+		merge(grants, map[Permission]Scope{permission: scope})
+	}
+
+	return grants, nil
+}
+
+func merge(into, from map[Permission]Scope) {
+	for permission, scope := range from {
+		if scope > into[permission] {
+			into[permission] = scope
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nillga/jwt-server/entity"
+)
+
+var (
+	user      = &entity.User{Id: "1"}
+	admin     = &entity.User{Id: "2", Admin: true}
+	moderator = &entity.User{Id: "3"}
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		user       *entity.User
+		permission Permission
+		want       Scope
+	}{
+		{user: user, permission: ReadMehms, want: Any},
+		{user: user, permission: EditMehms, want: Own},
+		{user: user, permission: DeleteUsers, want: Own},
+		{user: user, permission: ListUsers, want: None},
+		{user: user, permission: ManageAPIKeys, want: None},
+		{user: admin, permission: ListUsers, want: Any},
+		{user: admin, permission: EditMehms, want: Any},
+		{user: nil, permission: ReadMehms, want: None},
+	}
+
+	p, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if scope := p.Scope(test.user, test.permission); scope != test.want {
+			t.Errorf("Scope(%v, %s) = %d, want %d", test.user, test.permission, scope, test.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+		// checks hold the scope the moderator is expected to get per permission
+		checks map[Permission]Scope
+		roles  []string
+	}{
+		{
+			name: "YAML with inheritance and subjects",
+			file: "policy.yaml",
+			content: `
+roles:
+  user:
+    permissions: ["mehms:read", "comments:edit:own"]
+  moderator:
+    inherits: [user]
+    permissions: ["comments:edit", "comments:delete"]
+subjects:
+  "3": [moderator]
+`,
+			checks: map[Permission]Scope{ReadMehms: Any, EditComments: Any, DeleteComments: Any, DeleteMehms: None},
+			roles:  []string{"moderator", "user"},
+		},
+		{
+			name:    "JSON",
+			file:    "policy.json",
+			content: `{"roles": {"user": {"permissions": ["mehms:edit:own", "mehms:edit:own"]}}}`,
+			checks:  map[Permission]Scope{EditMehms: Own, ReadMehms: None},
+			roles:   []string{"user"},
+		},
+		{
+			name:    "own and any grant",
+			file:    "policy.yaml",
+			content: "roles:\n  user:\n    permissions: [\"mehms:edit:own\", \"mehms:edit\"]\n",
+			checks:  map[Permission]Scope{EditMehms: Any},
+			roles:   []string{"user"},
+		},
+		{name: "unknown field", file: "policy.yaml", content: "roles:\n  user:\n    grants: [\"*\"]\n", wantErr: "parsing policy file"},
+		{name: "unknown parent", file: "policy.yaml", content: "roles:\n  user:\n    inherits: [guest]\n", wantErr: "unknown role guest"},
+		{name: "cycle", file: "policy.yaml", content: "roles:\n  a:\n    inherits: [b]\n  b:\n    inherits: [a]\n", wantErr: "inherits from itself"},
+		{name: "unknown subject role", file: "policy.yaml", content: "roles:\n  user: {}\nsubjects:\n  \"3\": [moderator]\n", wantErr: "unknown role moderator"},
+		{name: "missing file", file: "missing.yaml", wantErr: "reading policy file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), test.file)
+			if test.content != "" {
+				if err := os.WriteFile(file, []byte(test.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p, err := Load(file)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roles := p.Roles(moderator); !reflect.DeepEqual(roles, test.roles) {
+				t.Errorf("Roles() = %v, want %v", roles, test.roles)
+			}
+			for permission, want := range test.checks {
+				if scope := p.Scope(moderator, permission); scope != want {
+					t.Errorf("Scope(%s) = %d, want %d", permission, scope, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package revocation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store remembers revoked tokens, either one by one through their jti or all
+// tokens of a user issued before a cutoff. Tokens without iat are judged by
+// their exp, assuming they were issued for the maximum lifetime.
+type Store interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	RevokeUser(userId string, cutoff time.Time) error
+	Revoked(jti, userId string, issuedAt, expiresAt time.Time) (bool, error)
+}
+
+// Backend is the key value store revocations are kept in. A Redis client is
+// easily adapted: Set maps to SET with PX, Get to GET.
+type Backend interface {
+	Set(key, value string, ttl time.Duration) error
+	Get(key string) (string, bool, error)
+}
+
+type store struct {
+	backend     Backend
+	maxLifetime time.Duration
+}
+
+// NewStore keeps user revocations for maxLifetime, after which every token
+// issued before the cutoff has expired anyway.
+func NewStore(backend Backend, maxLifetime time.Duration) Store {
+	return &store{backend: backend, maxLifetime: maxLifetime}
+}
+
+func (s *store) RevokeToken(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return fmt.Errorf("token has no id")
+	}
+	ttl := time.Until(expiresAt)
+	if expiresAt.IsZero() {
+		ttl = s.maxLifetime
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return s.backend.Set("jti:"+jti, "revoked", ttl)
+}
+
+// RevokeUser keeps the cutoff with sub-second precision, so a token issued
+// earlier in the same second as the cutoff is revoked as well.
+func (s *store) RevokeUser(userId string, cutoff time.Time) error {
+	return s.backend.Set("user:"+userId, cutoff.UTC().Format(time.RFC3339Nano), s.maxLifetime)
+}
+
+func (s *store) Revoked(jti, userId string, issuedAt, expiresAt time.Time) (bool, error) {
+	if jti != "" {
+		if _, ok, err := s.backend.Get("jti:" + jti); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	value, ok, err := s.backend.Get("user:" + userId)
+	if err != nil || !ok {
+		return false, err
+	}
+	cutoff, err := parseCutoff(value)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case !issuedAt.IsZero():
+		return issuedAt.Before(cutoff), nil
+	case !expiresAt.IsZero():
+		// a token expiring later than maxLifetime after the cutoff was issued after it
+		return expiresAt.Add(-s.maxLifetime).Before(cutoff), nil
+	}
+	// tokens with neither cannot prove they were issued after the cutoff
+	return true, nil
+}
+
+// parseCutoff reads a cutoff, also in the Unix seconds earlier versions stored.
+func parseCutoff(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+type entry struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type memoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	persist func(entries map[string]entry) error
+}
+
+func NewMemoryBackend() Backend {
+	return &memoryBackend{entries: map[string]entry{}}
+}
+
+// NewFileBackend keeps revocations in memory and writes them to file on every
+// change, so they survive restarts of a single gateway instance.
+func NewFileBackend(file string) (Backend, error) {
+	b := &memoryBackend{entries: map[string]entry{}}
+
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading revocation file: %w", err)
+	}
+	if len(content) > 0 {
+		if err = json.Unmarshal(content, &b.entries); err != nil {
+			return nil, fmt.Errorf("parsing revocation file %s: %w", file, err)
+		}
+	}
+
+	b.persist = func(entries map[string]entry) error {
+		content, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		tmp := file + ".tmp"
+		if err = os.WriteFile(tmp, content, 0600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, file)
+	}
+	return b, nil
+}
+
+func (b *memoryBackend) Set(key, value string, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range b.entries {
+		if now.After(e.ExpiresAt) {
+			delete(b.entries, k)
+		}
+	}
+	b.entries[key] = entry{Value: value, ExpiresAt: now.Add(ttl)}
+
+	if b.persist != nil {
+		return b.persist(b.entries)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Get(key string) (string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok || time.Now().After(e.ExpiresAt) {
+		return "", false, nil
+	}
+	return e.Value, true, nil
+}
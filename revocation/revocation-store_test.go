@@ -0,0 +1,101 @@
+package revocation
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRevoked(t *testing.T) {
+	const lifetime = 24 * time.Hour
+	cutoff := time.Now().Truncate(time.Second).Add(700 * time.Millisecond)
+	second := cutoff.Truncate(time.Second)
+	legacy := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		jti       string
+		userId    string
+		issuedAt  time.Time
+		expiresAt time.Time
+		want      bool
+	}{
+		{name: "issued before the cutoff", userId: "1", issuedAt: cutoff.Add(-time.Hour), want: true},
+		// iat holds whole seconds, so a token minted at cutoff-300ms carries the cutoff's second
+		{name: "issued in the same second before the cutoff", userId: "1", issuedAt: second, want: true},
+		{name: "issued in the next second", userId: "1", issuedAt: second.Add(time.Second)},
+		{name: "expiring within the lifetime of the cutoff", userId: "1", expiresAt: second.Add(lifetime), want: true},
+		{name: "expiring after the lifetime of the cutoff", userId: "1", expiresAt: second.Add(lifetime + time.Second)},
+		{name: "without iat and exp", userId: "1", want: true},
+		{name: "other user", userId: "2", issuedAt: cutoff.Add(-time.Hour)},
+		{name: "revoked token", jti: "revoked", userId: "2", issuedAt: cutoff.Add(-time.Hour), want: true},
+		{name: "other token", jti: "kept", userId: "2", issuedAt: cutoff.Add(-time.Hour)},
+		{name: "cutoff stored in seconds", userId: "legacy", issuedAt: legacy.Add(-time.Second), want: true},
+		{name: "after a cutoff stored in seconds", userId: "legacy", issuedAt: legacy},
+	}
+
+	backend := NewMemoryBackend()
+	s := NewStore(backend, lifetime)
+	if err := s.RevokeUser("1", cutoff); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeToken("revoked", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Set("user:legacy", strconv.FormatInt(legacy.Unix(), 10), lifetime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revoked, err := s.Revoked(test.jti, test.userId, test.issuedAt, test.expiresAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != test.want {
+				t.Errorf("Revoked() = %t, want %t", revoked, test.want)
+			}
+		})
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	s := NewStore(NewMemoryBackend(), time.Hour)
+
+	if err := s.RevokeToken("", time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("token without id was revoked")
+	}
+	// expired tokens need no revocation
+	if err := s.RevokeToken("expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := s.Revoked("expired", "1", time.Time{}, time.Time{}); revoked {
+		t.Errorf("expired token was kept")
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "revocations.json")
+	cutoff := time.Now()
+
+	backend, err := NewFileBackend(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewStore(backend, time.Hour).RevokeUser("1", cutoff); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileBackend(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := NewStore(reloaded, time.Hour).Revoked("", "1", cutoff.Add(-time.Millisecond), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Errorf("revocation did not survive a restart")
+	}
+}
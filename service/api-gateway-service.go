@@ -1,80 +1,368 @@
 package service
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/nillga/jwt-server/entity"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/jwks"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/revocation"
 )
 
 type Claims struct {
-	Id       string `json:"id"`
-	Username string `json:"username"`
-	Mail     string `json:"email"`
-	IsAdmin  bool   `json:"admin"`
+	Id       string   `json:"id"`
+	Username string   `json:"username"`
+	Mail     string   `json:"email"`
+	IsAdmin  bool     `json:"admin"`
+	Audience Audience `json:"aud,omitempty"`
 	jwt.StandardClaims
 }
 
+// Audience accepts the aud claim both as a single string and as an array.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) Contains(audience string) bool {
+	for _, candidate := range a {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate fails with one of these errors so clients can tell a token
+// worth refreshing from one that will never be accepted.
+var (
+	ErrMissingCredentials = errors.New("unauthenticated")
+	ErrMalformedToken     = errors.New("token is malformed")
+	ErrInvalidSignature   = errors.New("token signature is invalid")
+	ErrTokenExpired       = errors.New("token has expired")
+	ErrTokenNotYetValid   = errors.New("token is not valid yet")
+	ErrWrongIssuer        = errors.New("token was issued by an untrusted issuer")
+	ErrWrongAudience      = errors.New("token is not meant for this audience")
+	ErrTokenRevoked       = errors.New("token has been revoked")
+)
+
+// APIKeyHeader carries the API key of a service client. Keys may also be sent
+// as "Authorization: ApiKey <key>".
+const APIKeyHeader = "X-API-Key"
+
 type ApiGatewayService interface {
 	Authenticate(authorizationHeader string) (*entity.User, error)
+	// AuthenticateRequest reads the token from the Authorization header or the
+	// auth cookie, depending on the configured auth mode.
+	AuthenticateRequest(r *http.Request) (*entity.User, error)
+	TokenFromRequest(r *http.Request) (string, error)
+	// Verify checks a token completely and returns its claims.
+	Verify(token string) (*Claims, error)
+	RevokeToken(claims *Claims) error
+	// RevokeUser invalidates all tokens issued to the user so far, e.g. after
+	// the user was deleted or their admin status changed.
+	RevokeUser(userId string) error
+	// AuthenticateAPIKey resolves the API key of a request to a synthetic user
+	// and the key itself, whose scopes limit what the caller may do. The key is
+	// nil if the request carries no API key.
+	AuthenticateAPIKey(r *http.Request) (*entity.User, *apikey.Key, error)
 }
 
-type service struct{}
+type service struct {
+	secretKey  []byte
+	keys       jwks.KeySet
+	algorithms map[string]bool
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	revoked    revocation.Store
+	auth       config.Auth
+	apiKeys    apikey.Store
+}
 
-func NewApiGatewayService() ApiGatewayService {
-	return &service{}
+// NewApiGatewayService verifies tokens with the configured secret key for HMAC
+// algorithms and with keys for RSA and ECDSA ones. keys may be nil if no
+// asymmetric algorithm is allowed.
+func NewApiGatewayService(cfg *config.Config, keys jwks.KeySet, revoked revocation.Store, apiKeys apikey.Store) ApiGatewayService {
+	algorithms := make(map[string]bool, len(cfg.JWT.Algorithms))
+	for _, alg := range cfg.JWT.Algorithms {
+		algorithms[alg] = true
+	}
+
+	return &service{
+		secretKey:  []byte(cfg.SecretKey),
+		keys:       keys,
+		algorithms: algorithms,
+		issuer:     cfg.JWT.Issuer,
+		audience:   cfg.JWT.Audience,
+		leeway:     cfg.JWT.Leeway.Duration(),
+		revoked:    revoked,
+		auth:       cfg.Auth,
+		apiKeys:    apiKeys,
+	}
 }
 
 func (s *service) Authenticate(authorizationHeader string) (*entity.User, error) {
+	token, err := bearerToken(authorizationHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readToken(token)
+}
+
+func (s *service) AuthenticateRequest(r *http.Request) (*entity.User, error) {
+	token, err := s.TokenFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readToken(token)
+}
+
+func (s *service) TokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); s.auth.Bearer() && (header != "" || !s.auth.Cookies()) {
+		return bearerToken(header)
+	}
+
+	cookie, err := r.Cookie(s.auth.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", ErrMissingCredentials
+	}
+	return cookie.Value, nil
+}
+
+func (s *service) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+
+	if err := claims.decodeJwt(token, s.verificationKey); err != nil {
+		return nil, err
+	}
+	if err := s.validate(claims); err != nil {
+		return nil, err
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != 0 {
+		issuedAt = time.Unix(claims.IssuedAt, 0)
+	}
+	var expiresAt time.Time
+	if claims.ExpiresAt != 0 {
+		expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	revoked, err := s.revoked.Revoked(claims.StandardClaims.Id, claims.Id, issuedAt, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("checking revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+func (s *service) RevokeToken(claims *Claims) error {
+	var expiresAt time.Time
+	if claims.ExpiresAt != 0 {
+		expiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	return s.revoked.RevokeToken(claims.StandardClaims.Id, expiresAt)
+}
+
+func (s *service) RevokeUser(userId string) error {
+	return s.revoked.RevokeUser(userId, time.Now())
+}
+
+func (s *service) AuthenticateAPIKey(r *http.Request) (*entity.User, *apikey.Key, error) {
+	secret := r.Header.Get(APIKeyHeader)
+	if header := r.Header.Get("Authorization"); secret == "" && strings.HasPrefix(header, "ApiKey ") {
+		secret = strings.TrimSpace(strings.TrimPrefix(header, "ApiKey "))
+	}
+	if secret == "" {
+		return nil, nil, nil
+	}
+
+	key, err := s.apiKeys.Resolve(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &entity.User{
+		Id:       "apikey:" + key.Id,
+		Username: key.Name,
+		Admin:    key.HasScope(apikey.Admin),
+	}, key, nil
+}
+
+func bearerToken(authorizationHeader string) (string, error) {
 	if authorizationHeader == "" {
-		return nil, fmt.Errorf("unauthenticated")
+		return "", ErrMissingCredentials
 	}
 	credentials := strings.Split(authorizationHeader, "Bearer")
 	if len(credentials) != 2 {
-		return nil, fmt.Errorf("invalid credential format")
+		return "", fmt.Errorf("invalid credential format")
 	}
 	token := strings.TrimSpace(credentials[1])
 	if len(token) < 1 {
-		return nil, fmt.Errorf("invalid credentials")
+		return "", fmt.Errorf("invalid credentials")
 	}
+	return token, nil
+}
 
-	user, err := s.readToken(token)
-	if err != nil {
-		return nil, err
+func (c *Claims) decodeJwt(token string, keyFunc jwt.Keyfunc) error {
+	// time based claims are checked by validate, which allows for clock skew
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(token, c, keyFunc); err != nil {
+		var validationErr *jwt.ValidationError
+		if !errors.As(err, &validationErr) {
+			return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+		}
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return ErrMalformedToken
+		case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0:
+			return fmt.Errorf("%w: %v", ErrInvalidSignature, validationErr.Inner)
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return ErrInvalidSignature
+		}
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
 	}
-
-	return &entity.User{
-		Id:       user.Id,
-		Username: user.Username,
-		Email: user.Email,
-		Admin:    user.Admin,
-	}, nil
+	return nil
 }
 
-func (c *Claims) decodeJwt(token string) error {
-	if _, err := jwt.ParseWithClaims(token, c, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	}); err != nil {
-		return err
+func (s *service) validate(c *Claims) error {
+	now := time.Now()
+	leeway := int64(s.leeway / time.Second)
+
+	if c.ExpiresAt != 0 && now.Unix() > c.ExpiresAt+leeway {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Unix()+leeway < c.NotBefore {
+		return ErrTokenNotYetValid
+	}
+	if c.IssuedAt != 0 && now.Unix()+leeway < c.IssuedAt {
+		return fmt.Errorf("%w: issued in the future", ErrTokenNotYetValid)
+	}
+	if s.issuer != "" && c.Issuer != s.issuer {
+		return ErrWrongIssuer
+	}
+	if s.audience != "" && !c.Audience.Contains(s.audience) {
+		return ErrWrongAudience
 	}
 	return nil
 }
 
-var secretKey = os.Getenv("SECRET_KEY")
+// verificationKey picks the key for a token by its algorithm and kid header,
+// rejecting every algorithm that is not explicitly allowed.
+func (s *service) verificationKey(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	if !s.algorithms[alg] {
+		return nil, fmt.Errorf("signing method %s is not allowed", alg)
+	}
 
-func (s *service) readToken(token string) (*entity.User, error) {
-	claims := &Claims{}
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return s.secretKey, nil
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("no keys configured for signing method %s", alg)
+	}
 
-	if err := claims.decodeJwt(token); err != nil {
+	kid, _ := token.Header["kid"].(string)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key, err := s.keys.Key(ctx, kid)
+	if err != nil {
 		return nil, err
 	}
 
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok {
+			return ecKey, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q does not match signing method %s", kid, alg)
+}
+
+func (s *service) readToken(token string) (*entity.User, error) {
+	claims, err := s.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims.User(), nil
+}
+
+func (c *Claims) User() *entity.User {
 	return &entity.User{
-		Id:       claims.Id,
-		Username: claims.Username,
-		Email:    claims.Mail,
-		Admin:    claims.IsAdmin,
-	}, nil
+		Id:       c.Id,
+		Username: c.Username,
+		Email:    c.Mail,
+		Admin:    c.IsAdmin,
+	}
+}
+
+type contextKey struct{}
+
+type apiKeyContextKey struct{}
+
+// WithUser stores the authenticated user in the request context.
+func WithUser(ctx context.Context, user *entity.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user authenticated for the request, if any.
+func UserFromContext(ctx context.Context) (*entity.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*entity.User)
+	return user, ok && user != nil
+}
+
+// WithAPIKey stores the API key the request was authenticated with.
+func WithAPIKey(ctx context.Context, key *apikey.Key) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key the request was authenticated with, if any.
+func APIKeyFromContext(ctx context.Context) (*apikey.Key, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(*apikey.Key)
+	return key, ok && key != nil
+}
+
+// Scope tells how far the caller of the request may use permission: callers
+// with an API key by the scopes of the key, users by the access policy.
+func Scope(ctx context.Context, accessPolicy policy.Policy, permission policy.Permission) policy.Scope {
+	if key, ok := APIKeyFromContext(ctx); ok {
+		return key.Grants(permission)
+	}
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return policy.None
+	}
+	return accessPolicy.Scope(user, permission)
 }
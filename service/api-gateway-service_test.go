@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nillga/mehm-services-api-gateway/apikey"
+	"github.com/nillga/mehm-services-api-gateway/config"
+	"github.com/nillga/mehm-services-api-gateway/policy"
+	"github.com/nillga/mehm-services-api-gateway/revocation"
+)
+
+const secret = "secret"
+
+func newTestService(t *testing.T, apiKeys apikey.Store) ApiGatewayService {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.SecretKey = secret
+	cfg.JWT.Issuer = "mehms"
+	cfg.JWT.Audience = "gateway"
+	cfg.JWT.Leeway = config.Duration(30 * time.Second)
+	if apiKeys == nil {
+		var err error
+		if apiKeys, err = apikey.NewFileStore(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revoked := revocation.NewStore(revocation.NewMemoryBackend(), cfg.Revocation.TokenLifetime.Duration())
+	return NewApiGatewayService(cfg, nil, revoked, apiKeys)
+}
+
+// sign issues a token with the usual claims, overridden by claims. Claims set
+// to nil are left out.
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	now := time.Now()
+	all := jwt.MapClaims{
+		"id":       "1",
+		"username": "mehmer",
+		"email":    "mehmer@example.com",
+		"iss":      "mehms",
+		"aud":      "gateway",
+		"iat":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		if value == nil {
+			delete(all, name)
+		} else {
+			all[name] = value
+		}
+	}
+	token, err := jwt.NewWithClaims(method, all).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		claims jwt.MapClaims
+		want   error
+	}{
+		{name: "valid"},
+		{name: "audience in a list", claims: jwt.MapClaims{"aud": []string{"web", "gateway"}}},
+		{name: "without time claims", claims: jwt.MapClaims{"iat": nil, "exp": nil}},
+		{name: "expired", claims: jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}, want: ErrTokenExpired},
+		{name: "expired within leeway", claims: jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()}},
+		{name: "not valid yet", claims: jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}, want: ErrTokenNotYetValid},
+		{name: "not valid yet within leeway", claims: jwt.MapClaims{"nbf": now.Add(10 * time.Second).Unix()}},
+		{name: "issued in the future", claims: jwt.MapClaims{"iat": now.Add(time.Minute).Unix()}, want: ErrTokenNotYetValid},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "elsewhere"}, want: ErrWrongIssuer},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "web"}, want: ErrWrongAudience},
+		{name: "without audience", claims: jwt.MapClaims{"aud": nil}, want: ErrWrongAudience},
+		{name: "wrong secret", key: []byte("guessed"), want: ErrInvalidSignature},
+		{name: "algorithm not allowed", method: jwt.SigningMethodHS384, want: ErrInvalidSignature},
+		{name: "unsigned", method: jwt.SigningMethodNone, key: jwt.UnsafeAllowNoneSignatureType, want: ErrInvalidSignature},
+	}
+
+	s := newTestService(t, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method, key := test.method, test.key
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			if key == nil {
+				key = []byte(secret)
+			}
+
+			claims, err := s.Verify(sign(t, method, key, test.claims))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, test.want)
+			}
+			if err == nil && (claims.Id != "1" || claims.Username != "mehmer") {
+				t.Errorf("Verify() = %+v", claims)
+			}
+		})
+	}
+
+	if _, err := s.Verify("not.a.token"); !errors.Is(err, ErrMalformedToken) {
+		t.Errorf("Verify() of garbage error = %v, want %v", err, ErrMalformedToken)
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	now := time.Now()
+	lifetime := config.Default().Revocation.TokenLifetime.Duration()
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   error
+	}{
+		{name: "issued before the cutoff", claims: jwt.MapClaims{"iat": now.Add(-time.Minute).Unix()}, want: ErrTokenRevoked},
+		{name: "issued after the cutoff", claims: jwt.MapClaims{"iat": now.Add(10 * time.Second).Unix()}},
+		{name: "without iat, expiring early", claims: jwt.MapClaims{"iat": nil}, want: ErrTokenRevoked},
+		{name: "without iat, expiring late", claims: jwt.MapClaims{"iat": nil, "exp": now.Add(lifetime + time.Minute).Unix()}},
+		{name: "without time claims", claims: jwt.MapClaims{"iat": nil, "exp": nil}, want: ErrTokenRevoked},
+		{name: "revoked by id", claims: jwt.MapClaims{"id": "2", "jti": "revoked"}, want: ErrTokenRevoked},
+		{name: "other token of the user", claims: jwt.MapClaims{"id": "2", "jti": "kept"}},
+		{name: "other user", claims: jwt.MapClaims{"id": "3"}},
+	}
+
+	s := newTestService(t, nil)
+	if err := s.RevokeUser("1"); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.Verify(sign(t, jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"id": "2", "jti": "revoked"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.RevokeToken(claims); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := sign(t, jwt.SigningMethodHS256, []byte(secret), test.claims)
+			if _, err := s.Verify(token); !errors.Is(err, test.want) {
+				t.Errorf("Verify() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	apiKeys, err := apikey.NewFileStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := apiKeys.Create("reader", []apikey.Scope{apikey.ReadMehms}, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, admin, err := apiKeys.Create("admin", []apikey.Scope{apikey.Admin}, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		want       error
+		wantKey    bool
+		permission policy.Permission
+		wantScope  policy.Scope
+	}{
+		{name: "without key", header: "Authorization", value: "Bearer token"},
+		{name: "key header", header: APIKeyHeader, value: reader, wantKey: true, permission: policy.ReadMehms, wantScope: policy.Own},
+		{name: "authorization header", header: "Authorization", value: "ApiKey " + reader, wantKey: true, permission: policy.ReadComments, wantScope: policy.Own},
+		{name: "outside the scopes", header: APIKeyHeader, value: reader, wantKey: true, permission: policy.PostMehms, wantScope: policy.None},
+		{name: "admin scope", header: APIKeyHeader, value: admin, wantKey: true, permission: policy.DeleteUsers, wantScope: policy.Any},
+		{name: "unknown key", header: APIKeyHeader, value: "mk_unknown_key", want: apikey.ErrInvalidKey},
+		{name: "tampered key", header: APIKeyHeader, value: reader + "x", want: apikey.ErrInvalidKey},
+	}
+
+	accessPolicy, err := policy.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(t, apiKeys)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/mehms", nil)
+			r.Header.Set(test.header, test.value)
+
+			user, key, err := s.AuthenticateAPIKey(r)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("AuthenticateAPIKey() error = %v, want %v", err, test.want)
+			}
+			if (key != nil) != test.wantKey {
+				t.Fatalf("AuthenticateAPIKey() key = %v, want one: %t", key, test.wantKey)
+			}
+			if key == nil {
+				return
+			}
+			if key.Hash != "" {
+				t.Errorf("key hash was handed out")
+			}
+			ctx := WithAPIKey(WithUser(r.Context(), user), key)
+			if scope := Scope(ctx, accessPolicy, test.permission); scope != test.wantScope {
+				t.Errorf("Scope(%s) = %d, want %d", test.permission, scope, test.wantScope)
+			}
+		})
+	}
+}
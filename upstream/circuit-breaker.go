@@ -0,0 +1,220 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type State uint8
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerOptions control when a breaker trips and how it recovers.
+type BreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit.
+	FailureThreshold int
+	// SuccessThreshold is the number of consecutive successful probes that closes it again.
+	SuccessThreshold int
+	// Cooldown is how long the circuit stays open before probes are let through.
+	Cooldown time.Duration
+	// HalfOpenRequests limits the number of concurrent probes while half-open.
+	HalfOpenRequests int
+}
+
+func DefaultBreakerOptions() BreakerOptions {
+	return BreakerOptions{
+		FailureThreshold: 5,
+		SuccessThreshold: 2,
+		Cooldown:         15 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// OpenCircuitError is returned without contacting the upstream while its circuit is open.
+type OpenCircuitError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *OpenCircuitError) Error() string {
+	return fmt.Sprintf("upstream %s is unavailable, retry in %ds", e.Upstream, e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds rounds the remaining cooldown up to whole seconds as used by the Retry-After header.
+func (e *OpenCircuitError) RetryAfterSeconds() int {
+	return ceilSeconds(e.RetryAfter)
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+type BreakerStatus struct {
+	Upstream            string     `json:"upstream"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAfterSeconds   int        `json:"retryAfterSeconds,omitempty"`
+}
+
+// Breaker is a Client guarded by a circuit breaker.
+type Breaker interface {
+	Client
+	Status() BreakerStatus
+}
+
+type breaker struct {
+	Client
+	opts BreakerOptions
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+	// trips counts how often the circuit opened, telling apart requests sent
+	// before the last trip from the ones sent after it.
+	trips uint64
+}
+
+// ticket is handed out to a request let through by the breaker.
+type ticket struct {
+	probe bool
+	trips uint64
+}
+
+func NewBreaker(next Client, opts BreakerOptions) Breaker {
+	if opts.FailureThreshold < 1 {
+		opts.FailureThreshold = 1
+	}
+	if opts.SuccessThreshold < 1 {
+		opts.SuccessThreshold = 1
+	}
+	if opts.HalfOpenRequests < 1 {
+		opts.HalfOpenRequests = 1
+	}
+	return &breaker{Client: next, opts: opts}
+}
+
+func (b *breaker) Do(ctx context.Context, req *Request) (*http.Response, error) {
+	t, err := b.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.Client.Do(ctx, req)
+	b.record(ctx, t, res, err)
+	return res, err
+}
+
+func (b *breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Upstream:            b.Name(),
+		State:               b.state.String(),
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == Open {
+		status.RetryAfterSeconds = ceilSeconds(b.retryAfter())
+	}
+	return status
+}
+
+func (b *breaker) acquire() (ticket, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if b.retryAfter() > 0 {
+			return ticket{}, &OpenCircuitError{Upstream: b.Name(), RetryAfter: b.retryAfter()}
+		}
+		b.state = HalfOpen
+		b.successes = 0
+		b.probes = 0
+	}
+	t := ticket{trips: b.trips}
+	if b.state == HalfOpen {
+		if b.probes >= b.opts.HalfOpenRequests {
+			return ticket{}, &OpenCircuitError{Upstream: b.Name(), RetryAfter: time.Second}
+		}
+		b.probes++
+		t.probe = true
+	}
+	return t, nil
+}
+
+func (b *breaker) record(ctx context.Context, t ticket, res *http.Response, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// requests sent before the circuit last opened tell nothing about the upstream
+	// since then, and their late failures must not keep it open
+	if t.trips != b.trips {
+		return
+	}
+	if t.probe {
+		b.probes--
+	}
+
+	// a client hanging up tells nothing about the health of the upstream
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	if err != nil || res.StatusCode >= http.StatusInternalServerError {
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.opts.FailureThreshold {
+			b.trip()
+		}
+		return
+	}
+
+	b.failures = 0
+	if b.state == HalfOpen {
+		b.successes++
+		if b.successes >= b.opts.SuccessThreshold {
+			b.state = Closed
+		}
+	}
+}
+
+func (b *breaker) trip() {
+	b.trips++
+	b.state = Open
+	b.openedAt = time.Now()
+	b.successes = 0
+}
+
+func (b *breaker) retryAfter() time.Duration {
+	return time.Until(b.openedAt.Add(b.opts.Cooldown))
+}
@@ -0,0 +1,241 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnreachable = errors.New("connection refused")
+
+// fakeClient answers with do and counts its calls.
+type fakeClient struct {
+	mu    sync.Mutex
+	calls int
+	do    func(ctx context.Context, req *Request) (*http.Response, error)
+}
+
+func (c *fakeClient) Name() string {
+	return "fake"
+}
+
+func (c *fakeClient) BaseURL() string {
+	return "http://fake"
+}
+
+func (c *fakeClient) Do(ctx context.Context, req *Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+	return c.do(ctx, req)
+}
+
+func (c *fakeClient) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func status(code int) *http.Response {
+	return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+// outcome is the answer of the fake upstream to one request, an error if status is 0.
+type outcome struct {
+	status int
+	err    error
+}
+
+// script answers with the outcomes in turn, repeating the last one.
+func script(outcomes ...outcome) *fakeClient {
+	var mu sync.Mutex
+	next := 0
+	return &fakeClient{do: func(ctx context.Context, req *Request) (*http.Response, error) {
+		mu.Lock()
+		o := outcomes[next]
+		if next < len(outcomes)-1 {
+			next++
+		}
+		mu.Unlock()
+		if o.err != nil {
+			return nil, o.err
+		}
+		return status(o.status), nil
+	}}
+}
+
+func TestBreakerTrips(t *testing.T) {
+	opts := BreakerOptions{FailureThreshold: 3, SuccessThreshold: 1, Cooldown: time.Hour}
+	tests := []struct {
+		name      string
+		outcomes  []outcome
+		requests  int
+		wantState string
+		wantCalls int
+	}{
+		{name: "successes", outcomes: []outcome{{status: 200}}, requests: 5, wantState: "closed", wantCalls: 5},
+		{name: "client errors", outcomes: []outcome{{status: 404}}, requests: 5, wantState: "closed", wantCalls: 5},
+		{name: "server errors", outcomes: []outcome{{status: 503}}, requests: 5, wantState: "open", wantCalls: 3},
+		{name: "transport errors", outcomes: []outcome{{err: errUnreachable}}, requests: 5, wantState: "open", wantCalls: 3},
+		{
+			name:      "a success resets the failures",
+			outcomes:  []outcome{{status: 500}, {status: 500}, {status: 200}, {status: 500}, {status: 500}},
+			requests:  5,
+			wantState: "closed",
+			wantCalls: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := script(test.outcomes...)
+			b := NewBreaker(client, opts)
+
+			var lastErr error
+			for i := 0; i < test.requests; i++ {
+				_, lastErr = b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+			}
+
+			if client.count() != test.wantCalls {
+				t.Errorf("upstream was called %d times, want %d", client.count(), test.wantCalls)
+			}
+			status := b.Status()
+			if status.State != test.wantState {
+				t.Fatalf("state = %s, want %s", status.State, test.wantState)
+			}
+			if test.wantState != "open" {
+				return
+			}
+			var openErr *OpenCircuitError
+			if !errors.As(lastErr, &openErr) || openErr.RetryAfterSeconds() != 3600 {
+				t.Errorf("error = %v, want an open circuit for an hour", lastErr)
+			}
+			if status.OpenedAt == nil || status.RetryAfterSeconds != 3600 {
+				t.Errorf("status = %+v, want it opened an hour ago", status)
+			}
+		})
+	}
+}
+
+func TestBreakerRecovers(t *testing.T) {
+	tests := []struct {
+		name      string
+		probes    []outcome
+		wantState string
+	}{
+		{name: "successful probes close the circuit", probes: []outcome{{status: 200}, {status: 200}}, wantState: "closed"},
+		{name: "one successful probe is not enough", probes: []outcome{{status: 200}}, wantState: "half-open"},
+		{name: "a failed probe opens the circuit again", probes: []outcome{{status: 200}, {status: 502}}, wantState: "open"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := script(append([]outcome{{err: errUnreachable}}, test.probes...)...)
+			b := NewBreaker(client, BreakerOptions{FailureThreshold: 1, SuccessThreshold: 2, Cooldown: 10 * time.Millisecond})
+
+			b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+			time.Sleep(20 * time.Millisecond)
+			for range test.probes {
+				b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+			}
+
+			if state := b.Status().State; state != test.wantState {
+				t.Errorf("state = %s, want %s", state, test.wantState)
+			}
+		})
+	}
+}
+
+func TestBreakerLimitsProbes(t *testing.T) {
+	release := make(chan struct{})
+	probing := make(chan struct{})
+	client := script(outcome{err: errUnreachable})
+	fail := client.do
+	client.do = func(ctx context.Context, req *Request) (*http.Response, error) {
+		if req.Path == "/probe" {
+			close(probing)
+			<-release
+			return status(200), nil
+		}
+		return fail(ctx, req)
+	}
+	b := NewBreaker(client, BreakerOptions{FailureThreshold: 1, SuccessThreshold: 1, Cooldown: 10 * time.Millisecond, HalfOpenRequests: 1})
+
+	b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err := b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/probe"})
+		done <- err
+	}()
+	<-probing
+
+	var openErr *OpenCircuitError
+	if _, err := b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"}); !errors.As(err, &openErr) {
+		t.Errorf("second probe error = %v, want an open circuit", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if state := b.Status().State; state != "closed" {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+func TestBreakerIgnoresCanceledRequests(t *testing.T) {
+	client := script(outcome{err: context.Canceled})
+	b := NewBreaker(client, BreakerOptions{FailureThreshold: 1, SuccessThreshold: 1, Cooldown: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		b.Do(ctx, &Request{Method: http.MethodGet, Path: "/"})
+	}
+
+	if status := b.Status(); status.State != "closed" || status.ConsecutiveFailures != 0 {
+		t.Errorf("status = %+v, want closed without failures", status)
+	}
+}
+
+func TestBreakerIgnoresRequestsSentBeforeTrip(t *testing.T) {
+	release := make(chan struct{})
+	sent := make(chan struct{})
+	client := script(outcome{err: errUnreachable}, outcome{status: 200})
+	answer := client.do
+	client.do = func(ctx context.Context, req *Request) (*http.Response, error) {
+		if req.Path == "/slow" {
+			close(sent)
+			<-release
+			return nil, errUnreachable
+		}
+		return answer(ctx, req)
+	}
+	b := NewBreaker(client, BreakerOptions{FailureThreshold: 1, SuccessThreshold: 1, Cooldown: 10 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/slow"})
+	}()
+	<-sent
+
+	// trip, wait for the cooldown and close the circuit with a probe
+	b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+	time.Sleep(20 * time.Millisecond)
+	if _, err := b.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	<-done
+	if status := b.Status(); status.State != "closed" || status.ConsecutiveFailures != 0 {
+		t.Errorf("status = %+v, want closed without failures", status)
+	}
+}
@@ -0,0 +1,162 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryOptions control how idempotent upstream calls are retried.
+type RetryOptions struct {
+	// MaxAttempts bounds the attempts of a single request, the first one included.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the exponential backoff between attempts.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BudgetRatio is the share of requests that may be retried, e.g. 0.2 allows
+	// one retry per five requests. BudgetBurst caps the unused budget.
+	BudgetRatio float64
+	BudgetBurst float64
+}
+
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxAttempts: 3,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    time.Second,
+		BudgetRatio: 0.2,
+		BudgetBurst: 10,
+	}
+}
+
+type retrier struct {
+	Client
+	opts   RetryOptions
+	budget *retryBudget
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// retryBudget is a token bucket that fills with every request and empties with every retry.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	burst  float64
+	tokens float64
+}
+
+// NewRetrier retries transient failures of idempotent requests with exponential
+// backoff and full jitter. Non-idempotent methods such as POST are never
+// retried since calls like liking a mehm are toggles. Every retrier has a
+// budget of its own, so retries against one upstream never use up the
+// budget of another.
+func NewRetrier(next Client, opts RetryOptions) Client {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	return &retrier{
+		Client: next,
+		opts:   opts,
+		budget: &retryBudget{ratio: opts.BudgetRatio, burst: opts.BudgetBurst, tokens: opts.BudgetBurst},
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (r *retrier) Do(ctx context.Context, req *Request) (*http.Response, error) {
+	if !idempotent(req.Method) || r.opts.MaxAttempts == 1 {
+		return r.Client.Do(ctx, req)
+	}
+	r.budget.deposit()
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := *req
+		if body != nil {
+			attemptReq.Body = bytes.NewReader(body)
+		}
+
+		res, err := r.Client.Do(ctx, &attemptReq)
+		if attempt >= r.opts.MaxAttempts || !retryable(ctx, res, err) || !r.budget.withdraw() {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.backoff(attempt)):
+		}
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (r *retrier) backoff(attempt int) time.Duration {
+	ceiling := r.opts.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > r.opts.MaxDelay {
+		ceiling = r.opts.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.random.Int63n(int64(ceiling) + 1))
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRetrier(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		outcomes   []outcome
+		wantStatus int
+		wantErr    error
+		wantCalls  int
+	}{
+		{name: "success", method: http.MethodGet, outcomes: []outcome{{status: 200}}, wantStatus: 200, wantCalls: 1},
+		{name: "transient status", method: http.MethodGet, outcomes: []outcome{{status: 503}, {status: 502}, {status: 200}}, wantStatus: 200, wantCalls: 3},
+		{name: "transport error", method: http.MethodDelete, outcomes: []outcome{{err: errUnreachable}, {status: 200}}, wantStatus: 200, wantCalls: 2},
+		{name: "attempts used up", method: http.MethodGet, outcomes: []outcome{{status: 504}}, wantStatus: 504, wantCalls: 3},
+		{name: "errors of the request", method: http.MethodGet, outcomes: []outcome{{status: 404}, {status: 200}}, wantStatus: 404, wantCalls: 1},
+		{name: "internal errors", method: http.MethodGet, outcomes: []outcome{{status: 500}, {status: 200}}, wantStatus: 500, wantCalls: 1},
+		{name: "POST is not idempotent", method: http.MethodPost, outcomes: []outcome{{status: 503}, {status: 200}}, wantStatus: 503, wantCalls: 1},
+		{name: "last error", method: http.MethodGet, outcomes: []outcome{{err: errUnreachable}}, wantErr: errUnreachable, wantCalls: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := script(test.outcomes...)
+			r := NewRetrier(client, RetryOptions{MaxAttempts: 3, BudgetRatio: 1, BudgetBurst: 10})
+
+			res, err := r.Do(context.Background(), &Request{Method: test.method, Path: "/"})
+			if err != test.wantErr {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && res.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, test.wantStatus)
+			}
+			if client.count() != test.wantCalls {
+				t.Errorf("upstream was called %d times, want %d", client.count(), test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetrierResendsBody(t *testing.T) {
+	var bodies []string
+	client := &fakeClient{do: func(ctx context.Context, req *Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			return status(503), nil
+		}
+		return status(200), nil
+	}}
+	r := NewRetrier(client, RetryOptions{MaxAttempts: 2, BudgetRatio: 1, BudgetBurst: 1})
+
+	if _, err := r.Do(context.Background(), &Request{Method: http.MethodPut, Path: "/", Body: strings.NewReader("mehm")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != "mehm" || bodies[1] != "mehm" {
+		t.Errorf("bodies = %q, want the body twice", bodies)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RetryOptions
+		requests  int
+		wantCalls int
+	}{
+		// the burst allows one retry, the ratio adds none
+		{name: "used up", opts: RetryOptions{MaxAttempts: 3, BudgetRatio: 0, BudgetBurst: 1}, requests: 3, wantCalls: 4},
+		// every request deposits half a retry
+		{name: "refilled by requests", opts: RetryOptions{MaxAttempts: 2, BudgetRatio: 0.5, BudgetBurst: 1}, requests: 4, wantCalls: 6},
+		{name: "without budget", opts: RetryOptions{MaxAttempts: 3}, requests: 2, wantCalls: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := script(outcome{status: 503})
+			r := NewRetrier(client, test.opts)
+			for i := 0; i < test.requests; i++ {
+				r.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+			}
+			if client.count() != test.wantCalls {
+				t.Errorf("upstream was called %d times, want %d", client.count(), test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetPerClient(t *testing.T) {
+	opts := RetryOptions{MaxAttempts: 2, BudgetRatio: 0, BudgetBurst: 1}
+	users, mehms := script(outcome{status: 503}), script(outcome{status: 503})
+	usersRetrier, mehmsRetrier := NewRetrier(users, opts), NewRetrier(mehms, opts)
+
+	for i := 0; i < 3; i++ {
+		usersRetrier.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+	}
+	mehmsRetrier.Do(context.Background(), &Request{Method: http.MethodGet, Path: "/"})
+
+	if users.count() != 4 || mehms.count() != 2 {
+		t.Errorf("upstreams were called %d and %d times, want 4 and 2", users.count(), mehms.count())
+	}
+}
+
+func TestRetrierStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &fakeClient{do: func(context.Context, *Request) (*http.Response, error) {
+		cancel()
+		return status(503), nil
+	}}
+	r := NewRetrier(client, RetryOptions{MaxAttempts: 3, BudgetRatio: 1, BudgetBurst: 10})
+
+	r.Do(ctx, &Request{Method: http.MethodGet, Path: "/"})
+	if client.count() != 1 {
+		t.Errorf("upstream was called %d times, want 1", client.count())
+	}
+}
@@ -0,0 +1,131 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Request describes a call against an upstream service. Path is resolved
+// relative to the base URL of the client performing the call.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   io.Reader
+	Header http.Header
+}
+
+// Client performs requests against a single upstream service.
+// Callers are responsible for closing the body of every returned response.
+type Client interface {
+	Name() string
+	BaseURL() string
+	Do(ctx context.Context, req *Request) (*http.Response, error)
+}
+
+// Options tune timeouts and connection pooling of an upstream client.
+type Options struct {
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+}
+
+// DefaultOptions returns the options used by the gateway unless configured otherwise.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:               10 * time.Second,
+		DialTimeout:           3 * time.Second,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 8 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		MaxConnsPerHost:       64,
+	}
+}
+
+type client struct {
+	name    string
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(name, baseURL string, opts Options) Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   opts.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+	}
+
+	return &client{
+		name:    name,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+		},
+	}
+}
+
+func (c *client) Name() string {
+	return c.name
+}
+
+func (c *client) BaseURL() string {
+	return c.baseURL
+}
+
+func (c *client) Do(ctx context.Context, req *Request) (*http.Response, error) {
+	uri := c.baseURL + req.Path
+	if len(req.Query) > 0 {
+		uri += "?" + req.Query.Encode()
+	}
+
+	pr, err := http.NewRequestWithContext(ctx, req.Method, uri, req.Body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range req.Header {
+		for _, value := range values {
+			pr.Header.Add(key, value)
+		}
+	}
+	if req.Body != nil && pr.Header.Get("Content-Type") == "" {
+		pr.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.http.Do(pr)
+}
+
+// Ping reports whether the upstream answers at all. Any response below 500 counts as reachable.
+func Ping(ctx context.Context, c Client, path string) error {
+	res, err := c.Do(ctx, &Request{Method: http.MethodGet, Path: path})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s answered with status %d", c.Name(), res.StatusCode)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/nillga/jwt-server/errors"
+	"github.com/nillga/mehm-services-api-gateway/validation"
 )
 
 func InternalServerError(w http.ResponseWriter, err error) {
@@ -29,14 +30,36 @@ func BadGateway(w http.ResponseWriter, err error) {
 	errorSwitch(w, http.StatusBadGateway, err)
 }
 
+func GatewayTimeout(w http.ResponseWriter, err error) {
+	errorSwitch(w, http.StatusGatewayTimeout, err)
+}
+
+func ServiceUnavailable(w http.ResponseWriter, err error) {
+	errorSwitch(w, http.StatusServiceUnavailable, err)
+}
+
 func Forbidden(w http.ResponseWriter, err error) {
 	errorSwitch(w, http.StatusForbidden, err)
 }
 
+func RequestEntityTooLarge(w http.ResponseWriter, err error) {
+	errorSwitch(w, http.StatusRequestEntityTooLarge, err)
+}
+
+func UnsupportedMediaType(w http.ResponseWriter, err error) {
+	errorSwitch(w, http.StatusUnsupportedMediaType, err)
+}
+
 func UnprocessableEntity(w http.ResponseWriter, err error) {
 	errorSwitch(w, http.StatusUnprocessableEntity, err)
 }
 
+// InvalidInput answers with every failing field instead of a single message.
+func InvalidInput(w http.ResponseWriter, statusCode int, err *validation.Error) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(err)
+}
+
 func WrongStatus(w http.ResponseWriter, r *http.Response) {
 	w.WriteHeader(r.StatusCode)
 	if _, err := io.Copy(w, r.Body); err != nil {
@@ -0,0 +1,366 @@
+package validation
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	unmarshaler     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+var (
+	ErrBodyTooLarge = errors.New("request body is too large")
+	ErrMalformed    = errors.New("request body is not valid JSON")
+)
+
+// FieldError describes one field that broke a rule.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists every failing field of an input, so clients can fix all of them at once.
+type Error struct {
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return e.Message + ": " + strings.Join(messages, "; ")
+}
+
+// Decode reads the JSON body of r into v and validates it. Bodies above
+// maxSize fail with ErrBodyTooLarge, broken JSON with ErrMalformed, and
+// unknown fields, mistyped values and broken tag rules with *Error.
+func Decode(r *http.Request, v interface{}, maxSize int64) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > maxSize {
+		return ErrBodyTooLarge
+	}
+
+	var raw interface{}
+	if err = json.Unmarshal(body, &raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	var fields []FieldError
+	unknownFields(raw, reflect.TypeOf(v), "", &fields)
+	if err = json.Unmarshal(body, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		fields = append(fields, FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+		})
+	}
+	validate(reflect.ValueOf(v), "", &fields)
+	if len(fields) > 0 {
+		return &Error{Message: "invalid input", Fields: fields}
+	}
+	return nil
+}
+
+// Parsers turn query parameters into the field types they are registered
+// for, which may be pointed to. They come before encoding.TextUnmarshaler, so
+// types that depend on configuration, like genres, can be parsed.
+type Parsers map[reflect.Type]func(text string) (interface{}, error)
+
+// DecodeQuery sets the fields of the struct v points to from the query
+// parameters named by their query tags and validates them. Parameters
+// without a field are ignored, so they can be left out when forwarding.
+// Empty parameters count as missing and leave their field untouched.
+func DecodeQuery(values url.Values, v interface{}, parsers Parsers) error {
+	var fields []FieldError
+	target := reflect.ValueOf(v).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		name := field.Tag.Get("query")
+		given, ok := values[name]
+		if name == "" || !ok {
+			continue
+		}
+		if len(given) != 1 {
+			fields = append(fields, FieldError{Field: name, Rule: "single", Message: name + " must be given once"})
+			continue
+		}
+		if given[0] == "" {
+			continue
+		}
+
+		value := target.Field(i)
+		fieldType := value.Type()
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if parse, ok := parsers[fieldType]; ok {
+			parsed, err := parse(given[0])
+			if err != nil {
+				fields = append(fields, FieldError{Field: name, Rule: "value", Message: err.Error()})
+				continue
+			}
+			if value.Kind() == reflect.Ptr {
+				value.Set(reflect.New(fieldType))
+				value = value.Elem()
+			}
+			value.Set(reflect.ValueOf(parsed))
+			continue
+		}
+		if value.Kind() == reflect.Ptr && value.Type().Implements(textUnmarshaler) {
+			parsed := reflect.New(value.Type().Elem())
+			if err := parsed.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(given[0])); err != nil {
+				fields = append(fields, FieldError{Field: name, Rule: "value", Message: err.Error()})
+				continue
+			}
+			value.Set(parsed)
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(given[0])
+		case reflect.Int:
+			parsed, err := strconv.Atoi(given[0])
+			if err != nil {
+				fields = append(fields, FieldError{Field: name, Rule: "type", Message: name + " must be an integer"})
+				continue
+			}
+			value.SetInt(int64(parsed))
+		default:
+			return fmt.Errorf("unsupported query field type %s", value.Type())
+		}
+	}
+
+	validate(target, "", &fields)
+	if len(fields) > 0 {
+		return &Error{Message: "invalid query", Fields: fields}
+	}
+	return nil
+}
+
+// Validate checks the minlength, maxlength, minimum/min, maximum/max and enum tags of
+// v's fields, descending into nested structs and slices.
+func Validate(v interface{}) error {
+	var fields []FieldError
+	validate(reflect.ValueOf(v), "", &fields)
+	if len(fields) > 0 {
+		return &Error{Message: "invalid input", Fields: fields}
+	}
+	return nil
+}
+
+func validate(value reflect.Value, path string, fields *[]FieldError) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := join(path, jsonName(field))
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				name = path
+			}
+			checkField(value.Field(i), field.Tag, name, fields)
+			validate(value.Field(i), name, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validate(value.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	}
+}
+
+func checkField(value reflect.Value, tag reflect.StructTag, name string, fields *[]FieldError) {
+	fail := func(rule, format string, args ...interface{}) {
+		*fields = append(*fields, FieldError{Field: name, Rule: rule, Message: name + " " + fmt.Sprintf(format, args...)})
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.String && value.String() != "" {
+		if allowed, ok := tag.Lookup("enum"); ok && !contains(strings.Split(allowed, ","), value.String()) {
+			fail("enum", "must be one of %s", strings.ReplaceAll(allowed, ",", ", "))
+		}
+	}
+
+	length, unit := -1, "items"
+	switch value.Kind() {
+	case reflect.String:
+		length, unit = utf8.RuneCountInString(value.String()), "signs"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		length = value.Len()
+	}
+	if length >= 0 {
+		if min, ok := intTag(tag, "minlength"); ok && length < min {
+			fail("minlength", "must have at least %d %s", min, unit)
+		}
+		if max, ok := intTag(tag, "maxlength"); ok && length > max {
+			fail("maxlength", "must have at most %d %s", max, unit)
+		}
+	}
+
+	var number float64
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		number = value.Float()
+	default:
+		return
+	}
+	for _, rule := range []string{"minimum", "min"} {
+		if min, ok := floatTag(tag, rule); ok && number < min {
+			fail(rule, "must be at least %v", min)
+		}
+	}
+	for _, rule := range []string{"maximum", "max"} {
+		if max, ok := floatTag(tag, rule); ok && number > max {
+			fail(rule, "must be at most %v", max)
+		}
+	}
+}
+
+// unknownFields reports the keys of a decoded JSON document that t has no field for.
+func unknownFields(raw interface{}, t reflect.Type, path string, fields *[]FieldError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// types decoding themselves decide on their own which fields they accept
+	if reflect.PtrTo(t).Implements(unmarshaler) {
+		return
+	}
+
+	switch document := raw.(type) {
+	case map[string]interface{}:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		known := map[string]reflect.Type{}
+		collectFields(t, known)
+		keys := make([]string, 0, len(document))
+		for key := range document {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := document[key]
+			fieldType, ok := known[key]
+			if !ok {
+				for name, candidate := range known {
+					// encoding/json matches keys case-insensitively as well
+					if strings.EqualFold(name, key) {
+						fieldType, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				name := join(path, key)
+				*fields = append(*fields, FieldError{Field: name, Rule: "unknown", Message: name + " is not a known field"})
+				continue
+			}
+			unknownFields(value, fieldType, join(path, key), fields)
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for i, item := range document {
+			unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	}
+}
+
+func collectFields(t reflect.Type, known map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectFields(embedded, known)
+				continue
+			}
+		}
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		known[jsonName(field)] = field.Type
+	}
+}
+
+// jsonName returns the name a field is addressed by in JSON or, for query structs, in the URL.
+func jsonName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" {
+		return name
+	}
+	if name := field.Tag.Get("query"); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func intTag(tag reflect.StructTag, key string) (int, bool) {
+	value, err := strconv.Atoi(tag.Get(key))
+	return value, err == nil
+}
+
+func floatTag(tag reflect.StructTag, key string) (float64, bool) {
+	value, err := strconv.ParseFloat(tag.Get(key), 64)
+	return value, err == nil
+}
@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tag struct {
+	Name string `json:"name" minlength:"1" maxlength:"5"`
+}
+
+type post struct {
+	Title string  `json:"title" minlength:"3" maxlength:"10"`
+	Genre string  `json:"genre,omitempty" enum:"PROGRAMMING,DHBW"`
+	Likes int     `json:"likes" minimum:"0" maximum:"100"`
+	Tags  []tag   `json:"tags,omitempty" maxlength:"2"`
+	Note  *string `json:"note,omitempty" maxlength:"4"`
+}
+
+// genre parses itself from a query parameter, like dto.Genre.
+type genre string
+
+func (g *genre) UnmarshalText(text []byte) error {
+	if string(text) != "DHBW" && string(text) != "OTHER" {
+		return errors.New("genre must be DHBW or OTHER")
+	}
+	*g = genre(text)
+	return nil
+}
+
+// rank is parsed by the Parsers handed to DecodeQuery.
+type rank int
+
+var ranks = Parsers{
+	reflect.TypeOf(rank(0)): func(text string) (interface{}, error) {
+		switch text {
+		case "low":
+			return rank(1), nil
+		case "high":
+			return rank(2), nil
+		}
+		return nil, errors.New("rank must be low or high")
+	},
+}
+
+type page struct {
+	Skip  int    `query:"skip" minimum:"0"`
+	Take  int    `query:"take" min:"1" max:"50"`
+	Sort  string `query:"sort" enum:"createdDate,-createdDate"`
+	Genre *genre `query:"genre"`
+	Rank  *rank  `query:"rank"`
+}
+
+// rules lists the field and rule of every failure of err.
+func rules(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var invalid *Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	failed := make([]string, len(invalid.Fields))
+	for i, field := range invalid.Fields {
+		failed[i] = field.Field + ":" + field.Rule
+	}
+	return failed
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		// wantErr is set for errors other than *Error
+		wantErr error
+	}{
+		{name: "valid", input: `{"title":"mehm","genre":"DHBW","likes":3,"tags":[{"name":"go"}],"note":"ok"}`},
+		{name: "length counts signs, not bytes", input: `{"title":"äöüäöüäöüä"}`},
+		{name: "too short", input: `{"title":"ab"}`, want: []string{"title:minlength"}},
+		{name: "too long", input: `{"title":"abcdefghijk","note":"too long"}`, want: []string{"title:maxlength", "note:maxlength"}},
+		{name: "not in enum", input: `{"title":"mehm","genre":"OTHER"}`, want: []string{"genre:enum"}},
+		{name: "out of range", input: `{"title":"mehm","likes":101}`, want: []string{"likes:maximum"}},
+		{name: "below range", input: `{"title":"mehm","likes":-1}`, want: []string{"likes:minimum"}},
+		{
+			name:  "nested",
+			input: `{"title":"mehm","tags":[{"name":""},{"name":"toolong"},{"name":"x"}]}`,
+			want:  []string{"tags:maxlength", "tags[0].name:minlength", "tags[1].name:maxlength"},
+		},
+		{name: "unknown field", input: `{"title":"mehm","author":"me","tags":[{"name":"go","color":"red"}]}`, want: []string{"author:unknown", "tags[0].color:unknown"}},
+		{name: "mistyped", input: `{"title":"mehm","likes":"many"}`, want: []string{"likes:type"}},
+		{name: "all at once", input: `{"title":"ab","genre":"OTHER","likes":200}`, want: []string{"title:minlength", "genre:enum", "likes:maximum"}},
+		{name: "malformed", input: `{"title":`, wantErr: ErrMalformed},
+		{name: "too large", input: `{"title":"` + strings.Repeat("x", 200) + `"}`, wantErr: ErrBodyTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(test.input))
+			var p post
+			err := Decode(r, &p, 128)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if got := rules(t, err); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Decode() failed %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeQuery(t *testing.T) {
+	dhbw, high := genre("DHBW"), rank(2)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+		page  page
+	}{
+		{name: "defaults", query: "", page: page{Take: 20}},
+		{name: "valid", query: "skip=20&take=10&sort=-createdDate", page: page{Skip: 20, Take: 10, Sort: "-createdDate"}},
+		{name: "unknown parameters are ignored", query: "take=5&shape=legacy", page: page{Take: 5}},
+		{name: "out of range", query: "skip=-1&take=51", want: []string{"skip:minimum", "take:max"}},
+		{name: "not a number", query: "take=many", want: []string{"take:type"}},
+		{name: "not in enum", query: "sort=likes", want: []string{"sort:enum"}},
+		{name: "repeated", query: "take=5&take=6", want: []string{"take:single"}},
+		{name: "genre", query: "genre=DHBW", page: page{Take: 20, Genre: &dhbw}},
+		{name: "unknown genre", query: "genre=MEMES", want: []string{"genre:value"}},
+		{name: "empty genre is left out", query: "genre=", page: page{Take: 20}},
+		{name: "empty numbers are left out", query: "skip=&take=", page: page{Take: 20}},
+		{name: "empty sort is left out", query: "sort=&take=5", page: page{Take: 5}},
+		{name: "parsed", query: "rank=high", page: page{Take: 20, Rank: &high}},
+		{name: "not parsed", query: "rank=medium", want: []string{"rank:value"}},
+		{name: "empty rank is left out", query: "rank=", page: page{Take: 20}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := page{Take: 20}
+			err = DecodeQuery(values, &p, ranks)
+			if got := rules(t, err); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("DecodeQuery() failed %v, want %v", got, test.want)
+			}
+			if test.want == nil && !reflect.DeepEqual(p, test.page) {
+				t.Errorf("DecodeQuery() = %+v, want %+v", p, test.page)
+			}
+		})
+	}
+}